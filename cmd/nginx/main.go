@@ -6,13 +6,20 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/controller"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/defaultbackend"
 	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/handlers"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/healthcheck"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/metrics"
 	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/nginx"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/utils"
 	"github.com/golang/glog"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -24,13 +31,56 @@ var (
 		`Use a proxy server to connect to Kubernetes API started by "kubectl proxy" command. For testing purposes only.
 	The Ingress controller does not start NGINX and does not write any generated NGINX configuration files to disk`)
 
-	namespace = flag.String("namespace", "mini-nginx-ingress", "ingress namespace")
+	namespace = flag.String("namespace", "mini-nginx-ingress",
+		`Comma separated list of the namespaces to watch for Ingress resources. An empty value watches all namespaces.
+	With -watch-namespace-selector and without this argument, all namespaces are watched`)
+
+	watchNamespaceSelector = flag.String("watch-namespace-selector", "",
+		`Label selector of the namespaces to watch for Ingress resources, e.g. "ingress=mini-nginx".
+	Namespaces that start or stop matching are added or removed dynamically`)
 
 	ingressClass = flag.String("ingressClass", "mini-ingress-nginx", "ingress class")
 
 	mainTemplatePath = flag.String("main-template-path", "",
 		`Path to the main NGINX configuration template. (default for NGINX "nginx.tmpl"; default for NGINX Plus "nginx-plus.tmpl")`)
 
+	nginxConfigMaps = flag.String("nginx-configmaps", "",
+		`A ConfigMap resource for customizing NGINX configuration. Format: <namespace>/<name>`)
+
+	tcpServicesConfigMap = flag.String("tcp-services-configmap", "",
+		`A ConfigMap resource with the TCP services to expose. Format: <namespace>/<name>.
+	Each entry maps an external port to a service: <port>: "<namespace>/<service>:<service port>[:PROXY]"`)
+
+	udpServicesConfigMap = flag.String("udp-services-configmap", "",
+		`A ConfigMap resource with the UDP services to expose. Format: <namespace>/<name>.
+	Each entry maps an external port to a service: <port>: "<namespace>/<service>:<service port>"`)
+
+	healthChecks = flag.Bool("health-checks", false,
+		`Enable active health checks of the backend endpoints based on the HTTP readiness probes of their pods.
+	Endpoints that fail the checks are removed from the upstreams. Use the nginx.org/health-checks annotation to disable them for an Ingress`)
+
+	healthCheckInterval = flag.Duration("health-check-interval", 0,
+		`Interval between health checks of an endpoint. (default the periodSeconds of the readiness probe)`)
+
+	healthCheckTimeout = flag.Duration("health-check-timeout", 0,
+		`Timeout of a health check. (default the timeoutSeconds of the readiness probe)`)
+
+	healthCheckFails = flag.Int("health-check-fails", 0,
+		`Number of failed health checks in a row after which an endpoint is considered unhealthy. (default the failureThreshold of the readiness probe)`)
+
+	healthCheckPasses = flag.Int("health-check-passes", 0,
+		`Number of passed health checks in a row after which an unhealthy endpoint is considered healthy again. (default the successThreshold of the readiness probe)`)
+
+	reloadMinInterval = flag.Duration("reload-min-interval", nginx.DefaultReloadMinInterval,
+		`Time without changes of the configuration NGINX waits for before reloading, so the changes are applied together.
+	Reloads are at least this interval apart`)
+
+	reloadMaxDelay = flag.Duration("reload-max-delay", nginx.DefaultReloadMaxDelay,
+		`Maximum time a change of the configuration waits for the reload of NGINX, even if other changes keep coming`)
+
+	metricsPort = flag.Int("metrics-port", 9113,
+		`Port to serve the controller metrics on at /debug/vars. 0 disables the metrics`)
+
 	ingressTemplatePath = flag.String("ingress-template-path", "",
 		`Path to the ingress NGINX configuration template for an ingress resource.
 	(default for NGINX "nginx.ingress.tmpl"; default for NGINX Plus "nginx-plus.ingress.tmpl")`)
@@ -76,6 +126,29 @@ func main() {
 		nginxIngressTemplatePath = *ingressTemplatePath
 	}
 
+	cfg := nginx.NewDefaultConfig()
+	if *nginxConfigMaps != "" {
+		ns, name, err := utils.ParseNamespaceName(*nginxConfigMaps)
+		if err != nil {
+			log.Fatalf("Error parsing the nginx-configmaps argument: %v", err)
+		}
+		cfm, err := kubeClient.Core().ConfigMaps(ns).Get(name, meta_v1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Error when getting %v: %v", *nginxConfigMaps, err)
+		}
+		cfg = nginx.ParseConfigMap(cfm)
+	}
+
+	defaultBackend := defaultbackend.NewServer()
+	if err := defaultBackend.UpdateTemplates(cfg.DefaultBackendHTMLTemplate, cfg.DefaultBackendJSONTemplate); err != nil {
+		log.Printf("Error parsing the default backend templates: %v, using the defaults", err)
+	}
+	go func() {
+		if err := defaultBackend.ListenAndServe(nginx.DefaultServerAddress + ":" + nginx.DefaultServerPort); err != nil {
+			log.Fatalf("Error serving the default backend: %v", err)
+		}
+	}()
+
 	nginxBinaryPath := "/usr/sbin/nginx"
 	ngxc := nginx.NewNginxController("/etc/nginx/", nginxBinaryPath, false)
 
@@ -84,23 +157,51 @@ func main() {
 		log.Fatalf("Error creating TemplateExecutor: %v", err)
 	}
 
-	content, err := templateExecutor.ExecuteMainConfigTemplate()
+	cfg.ProxyCacheZones = ngxc.CreateCacheDirs(cfg.ProxyCacheZones)
+
+	content, err := templateExecutor.ExecuteMainConfigTemplate(nginx.GenerateMainConfig(cfg))
 	if err != nil {
 		glog.Fatalf("Error generating NGINX main config: %v", err)
 	}
 	ngxc.UpdateMainConfigFile(content)
+	if _, _, err := ngxc.Apply(); err != nil {
+		glog.Fatalf("Error applying NGINX main config: %v", err)
+	}
 
-	cnf := nginx.NewNgxConfig(ngxc, templateExecutor)
+	cnf := nginx.NewNgxConfig(ngxc, cfg, templateExecutor)
 
 	nginxDone := make(chan error, 1)
 	ngxc.Start(nginxDone)
 
 	lbcInput := controller.NewLoadBalancerControllerInput{
-		KubeClient:        kubeClient,
-		ResyncPeriod:      30 * time.Second,
-		NginxConfigurator: cnf,
-		Namespace:         *namespace,
-		IngressClass:      *ingressClass,
+		KubeClient:           kubeClient,
+		ResyncPeriod:         30 * time.Second,
+		NginxConfigurator:    cnf,
+		Namespaces:           getNamespaces(),
+		IngressClass:         *ingressClass,
+		ConfigMaps:           *nginxConfigMaps,
+		TCPServicesConfigMap: *tcpServicesConfigMap,
+		UDPServicesConfigMap: *udpServicesConfigMap,
+		DefaultBackend:       defaultBackend,
+		ReloadMinInterval:    *reloadMinInterval,
+		ReloadMaxDelay:       *reloadMaxDelay,
+	}
+
+	if *watchNamespaceSelector != "" {
+		selector, err := labels.Parse(*watchNamespaceSelector)
+		if err != nil {
+			log.Fatalf("Error parsing the watch-namespace-selector argument: %v", err)
+		}
+		lbcInput.NamespaceSelector = selector
+	}
+
+	if *healthChecks {
+		lbcInput.HealthChecks = &healthcheck.Config{
+			Interval: *healthCheckInterval,
+			Timeout:  *healthCheckTimeout,
+			Fails:    int32(*healthCheckFails),
+			Passes:   int32(*healthCheckPasses),
+		}
 	}
 
 	lbc := controller.NewLoadBalancerController(lbcInput)
@@ -113,6 +214,33 @@ func main() {
 	lbc.AddIngressHandler(ingressHandlers)
 	lbc.AddEndpointHandler(endpointHandlers)
 	lbc.AddServiceHandler(svcHandlers)
+	lbc.AddSecretHandler(handlers.CreateSecretHandlers(lbc))
+	lbc.AddNamespaceHandler(handlers.CreateNamespaceHandlers(lbc))
+
+	// config maps with custom error pages live in the namespace of their Ingress,
+	// watch all namespaces if the NGINX ConfigMap or the stream services ConfigMaps are in another one
+	configMapNamespace := lbc.WatchNamespace()
+	for name, value := range map[string]string{
+		"nginx-configmaps":       *nginxConfigMaps,
+		"tcp-services-configmap": *tcpServicesConfigMap,
+		"udp-services-configmap": *udpServicesConfigMap,
+	} {
+		if value == "" {
+			continue
+		}
+		ns, _, err := utils.ParseNamespaceName(value)
+		if err != nil {
+			log.Fatalf("Error parsing the %v argument: %v", name, err)
+		}
+		if ns != configMapNamespace {
+			configMapNamespace = ""
+		}
+	}
+	lbc.AddConfigMapHandler(handlers.CreateConfigMapHandlers(lbc), configMapNamespace)
+
+	if *metricsPort != 0 {
+		go metrics.ListenAndServe(*metricsPort)
+	}
 
 	go handleTermination(lbc, ngxc, nginxDone)
 
@@ -121,6 +249,37 @@ func main() {
 	fmt.Printf("End Ingress Nginx")
 }
 
+// getNamespaces returns the namespaces of the namespace argument. Only a namespace selector is applied when
+// it's given without the namespace argument, rather than the default namespace that it may not match.
+func getNamespaces() []string {
+	if *watchNamespaceSelector != "" && !isFlagPassed("namespace") {
+		return nil
+	}
+	return parseNamespaces(*namespace)
+}
+
+// isFlagPassed reports whether the flag is given on the command line rather than left to its default
+func isFlagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// parseNamespaces parses the comma separated namespaces of the namespace argument
+func parseNamespaces(value string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(value, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
 func handleTermination(lbc *controller.LoadBalancerController, ngxc *nginx.Controller, nginxDone chan error) {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGTERM)
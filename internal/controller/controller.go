@@ -3,8 +3,12 @@ package controller
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/defaultbackend"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/healthcheck"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/metrics"
 	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/nginx"
 	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/queue"
 	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/utils"
@@ -12,8 +16,8 @@ import (
 
 	api_v1 "k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
@@ -21,47 +25,96 @@ import (
 )
 
 const (
-	ingressClassKey = "kubernetes.io/ingress.class"
+	ingressClassKey            = "kubernetes.io/ingress.class"
+	customErrorPagesAnnotation = "nginx.org/custom-error-pages"
+	fastCGIParamsAnnotation    = "nginx.org/fastcgi-params"
 )
 
+// initialSyncRetryInterval is the interval between the attempts of the initial sync
+const initialSyncRetryInterval = 5 * time.Second
+
 // LoadBalancerController watches Kubernetes API and
 // reconfigures NGINX via NginxController when needed
 type LoadBalancerController struct {
-	client             kubernetes.Interface
-	ingressController  cache.Controller
-	namespace          string
-	resync             time.Duration
-	ingressClass       string
-	ingressLister      utils.StoreToIngressLister
-	svcController      cache.Controller
-	svcLister          cache.Store
-	endpointLister     utils.StoreToEndpointLister
-	endpointController cache.Controller
+	client            kubernetes.Interface
+	namespaces        []string
+	namespaceSelector labels.Selector
+	// selectedNamespaces holds the namespaces that match the namespace selector
+	selectedNamespaces     map[string]bool
+	selectedNamespacesLock sync.Mutex
+	resync                 time.Duration
+	ingressClass           string
+	informers              informerFactory
+	ingressLister          utils.IngressLister
+	svcLister              utils.ServiceLister
+	endpointLister         utils.EndpointLister
+	configMapLister        utils.ConfigMapLister
+	secretLister           utils.SecretLister
+	podLister              utils.PodLister
+	nginxConfigMaps        string
+	tcpServicesConfigMap   string
+	udpServicesConfigMap   string
+	// streamServices holds the keys of the services referenced by the stream services
+	streamServices     map[string]bool
+	streamServicesLock sync.Mutex
 	stopChan           chan struct{}
 	syncQueue          *queue.TaskQueue
 	configurator       *nginx.NgxConfig
+	healthChecker      *healthcheck.Checker
+	reloadMinInterval  time.Duration
+	reloadMaxDelay     time.Duration
+	defaultBackend     *defaultbackend.Server
 }
 
 // NewLoadBalancerControllerInput holds the input needed to call NewLoadBalancerController.
 type NewLoadBalancerControllerInput struct {
-	KubeClient        kubernetes.Interface
-	ResyncPeriod      time.Duration
-	NginxConfigurator *nginx.NgxConfig
-	Namespace         string
-	IngressClass      string
+	KubeClient           kubernetes.Interface
+	ResyncPeriod         time.Duration
+	NginxConfigurator    *nginx.NgxConfig
+	Namespaces           []string
+	NamespaceSelector    labels.Selector
+	IngressClass         string
+	ConfigMaps           string
+	TCPServicesConfigMap string
+	UDPServicesConfigMap string
+	HealthChecks         *healthcheck.Config
+	ReloadMinInterval    time.Duration
+	ReloadMaxDelay       time.Duration
+	DefaultBackend       *defaultbackend.Server
 }
 
 // NewLoadBalancerController creates a controller
 func NewLoadBalancerController(input NewLoadBalancerControllerInput) *LoadBalancerController {
 	lbc := LoadBalancerController{
-		namespace:    input.Namespace,
-		resync:       input.ResyncPeriod,
-		client:       input.KubeClient,
-		ingressClass: input.IngressClass,
-		stopChan:     make(chan struct{}),
-		configurator: input.NginxConfigurator,
+		namespaces:           input.Namespaces,
+		namespaceSelector:    input.NamespaceSelector,
+		selectedNamespaces:   make(map[string]bool),
+		resync:               input.ResyncPeriod,
+		client:               input.KubeClient,
+		ingressClass:         input.IngressClass,
+		nginxConfigMaps:      input.ConfigMaps,
+		tcpServicesConfigMap: input.TCPServicesConfigMap,
+		udpServicesConfigMap: input.UDPServicesConfigMap,
+		stopChan:             make(chan struct{}),
+		configurator:         input.NginxConfigurator,
+		defaultBackend:       input.DefaultBackend,
+		reloadMinInterval:    input.ReloadMinInterval,
+		reloadMaxDelay:       input.ReloadMaxDelay,
+		informers:            informerFactory{resync: input.ResyncPeriod},
 	}
 	lbc.syncQueue = queue.NewTaskQueue(lbc.sync)
+	lbc.configurator.SetIngressErrorHandler(lbc.recordIngressError)
+
+	// the pods are only looked up, for the named target ports and the readiness probes of the services
+	podInformer := lbc.informers.newInformer(lbc.client.Core().RESTClient(), "pods", lbc.watchNamespace(), &api_v1.Pod{}, nil)
+	lbc.podLister.Indexer = podInformer.GetIndexer()
+	if input.HealthChecks != nil {
+		lbc.healthChecker = healthcheck.NewChecker(*input.HealthChecks, func(owners []string) {
+			for _, key := range owners {
+				lbc.enqueueIngressByKey(key)
+			}
+		})
+	}
 	return &lbc
 }
 
@@ -80,55 +133,96 @@ func (lbc *LoadBalancerController) IsNginxIngress(ing *extensions.Ingress) bool
 
 // AddServiceHandler adds the handler for services to the controller
 func (lbc *LoadBalancerController) AddServiceHandler(handlers cache.ResourceEventHandlerFuncs) {
-	lbc.svcLister, lbc.svcController = cache.NewInformer(
-		cache.NewListWatchFromClient(
-			lbc.client.Core().RESTClient(),
-			"services",
-			lbc.namespace,
-			fields.Everything()),
-		&api_v1.Service{},
-		lbc.resync,
-		handlers,
-	)
+	informer := lbc.informers.newInformer(lbc.client.Core().RESTClient(), "services", lbc.watchNamespace(), &api_v1.Service{}, nil)
+	informer.AddEventHandler(handlers)
+	lbc.svcLister.Indexer = informer.GetIndexer()
 }
 
 // AddIngressHandler adds the handler for ingresses to the controller
 func (lbc *LoadBalancerController) AddIngressHandler(handlers cache.ResourceEventHandlerFuncs) {
-	lbc.ingressLister.Store, lbc.ingressController = cache.NewInformer(
-		cache.NewListWatchFromClient(
-			lbc.client.Extensions().RESTClient(),
-			"ingresses",
-			lbc.namespace,
-			fields.Everything()),
-		&extensions.Ingress{},
-		lbc.resync,
-		handlers,
-	)
+	informer := lbc.informers.newInformer(lbc.client.Extensions().RESTClient(), "ingresses", lbc.watchNamespace(), &extensions.Ingress{}, ingressIndexers)
+	informer.AddEventHandler(handlers)
+	lbc.ingressLister.Indexer = informer.GetIndexer()
 }
 
 // AddEndpointHandler adds the handler for endpoints to the controller
 func (lbc *LoadBalancerController) AddEndpointHandler(handlers cache.ResourceEventHandlerFuncs) {
-	lbc.endpointLister.Store, lbc.endpointController = cache.NewInformer(
-		cache.NewListWatchFromClient(
-			lbc.client.Core().RESTClient(),
-			"endpoints",
-			lbc.namespace,
-			fields.Everything()),
-		&api_v1.Endpoints{},
-		lbc.resync,
-		handlers,
-	)
-}
-
-// Run starts the loadbalancerController controller
+	informer := lbc.informers.newInformer(lbc.client.Core().RESTClient(), "endpoints", lbc.watchNamespace(), &api_v1.Endpoints{}, nil)
+	informer.AddEventHandler(handlers)
+	lbc.endpointLister.Indexer = informer.GetIndexer()
+}
+
+// AddConfigMapHandler adds the handler for config maps to the controller
+func (lbc *LoadBalancerController) AddConfigMapHandler(handlers cache.ResourceEventHandlerFuncs, namespace string) {
+	informer := lbc.informers.newInformer(lbc.client.Core().RESTClient(), "configmaps", namespace, &api_v1.ConfigMap{}, nil)
+	informer.AddEventHandler(handlers)
+	lbc.configMapLister.Indexer = informer.GetIndexer()
+}
+
+// AddSecretHandler adds the handler for secrets to the controller
+func (lbc *LoadBalancerController) AddSecretHandler(handlers cache.ResourceEventHandlerFuncs) {
+	informer := lbc.informers.newInformer(lbc.client.Core().RESTClient(), "secrets", lbc.watchNamespace(), &api_v1.Secret{}, nil)
+	informer.AddEventHandler(handlers)
+	lbc.secretLister.Indexer = informer.GetIndexer()
+}
+
+// Run starts the informers, waits for their caches to be synced and starts processing the sync queue
 func (lbc *LoadBalancerController) Run() {
-	go lbc.svcController.Run(lbc.stopChan)
-	go lbc.endpointController.Run(lbc.stopChan)
-	go lbc.ingressController.Run(lbc.stopChan)
+	lbc.informers.Start(lbc.stopChan)
+	if lbc.healthChecker != nil {
+		go lbc.healthChecker.Run(lbc.stopChan)
+	}
+
+	log.Printf("Waiting for the caches to be synced")
+	if !lbc.informers.WaitForCacheSync(lbc.stopChan) {
+		return
+	}
+
+	// the initial sync covers the tasks queued while the caches were filled. The controller is only ready
+	// once the initial configuration is applied, so the sync is retried until it is.
+	for {
+		lbc.syncQueue.Clear()
+		if err := lbc.initialSync(); err == nil {
+			break
+		}
+		select {
+		case <-time.After(initialSyncRetryInterval):
+		case <-lbc.stopChan:
+			return
+		}
+	}
+	metrics.Ready.Set(1)
+	log.Printf("Initial sync done, syncing the changes of the resources")
+
+	go lbc.configurator.RunReloads(lbc.reloadMinInterval, lbc.reloadMaxDelay, lbc.stopChan)
 	go lbc.syncQueue.Run(time.Second, lbc.stopChan)
 	lbc.Wait()
 }
 
+// initialSync generates the configuration of all the Ingresses and stream services at once,
+// so NGINX is reloaded a single time at startup
+func (lbc *LoadBalancerController) initialSync() error {
+	cfg, err := lbc.getConfig(lbc.nginxConfigMaps)
+	if err != nil {
+		glog.Errorf("Error getting ConfigMap %v: %v, using the default configuration", lbc.nginxConfigMaps, err)
+		cfg = nginx.NewDefaultConfig()
+	}
+
+	streams, err := lbc.getStreams()
+	if err != nil {
+		glog.Errorf("Error getting the stream services: %v", err)
+	}
+
+	ingExes := lbc.getIngressesForConfig()
+
+	if err := lbc.configurator.Initialize(cfg, ingExes, streams); err != nil {
+		glog.Errorf("Error applying the initial NGINX config: %v, retrying in %v", err, initialSyncRetryInterval)
+		return err
+	}
+	log.Printf("Applied the initial NGINX config with %v Ingresses and %v stream services", len(ingExes), len(streams))
+	return nil
+}
+
 // Wait the loadbalancerController stop
 func (lbc *LoadBalancerController) Wait() {
 	<-lbc.stopChan
@@ -142,7 +236,76 @@ func (lbc *LoadBalancerController) sync(task queue.Task) {
 	case queue.Endpoints:
 		lbc.syncEndpoint(task)
 		return
+	case queue.ConfigMap:
+		if lbc.isStreamConfigMapKey(task.Key) {
+			lbc.syncStreams(task)
+			return
+		}
+		lbc.syncConfig(task)
+		return
+	}
+}
+
+// IsNginxConfigMap checks if the ConfigMap is the one holding the NGINX configuration
+func (lbc *LoadBalancerController) IsNginxConfigMap(cfgm *api_v1.ConfigMap) bool {
+	return cfgm.Namespace+"/"+cfgm.Name == lbc.nginxConfigMaps
+}
+
+func (lbc *LoadBalancerController) syncConfig(task queue.Task) {
+	key := task.Key
+	cfg, err := lbc.getConfig(key)
+	if err != nil {
+		lbc.syncQueue.Requeue(task, err)
+		return
+	}
+
+	ingExes := lbc.getIngressesForConfig()
+
+	if err := lbc.configurator.UpdateConfig(cfg, ingExes); err != nil {
+		glog.Errorf("Error updating NGINX config from ConfigMap %v: %v", key, err)
+	} else {
+		log.Printf("Updated NGINX config from ConfigMap %v", key)
+	}
+}
+
+// getConfig returns the configuration of the NGINX ConfigMap, or the default one if it doesn't exist,
+// and updates the templates of the default backend
+func (lbc *LoadBalancerController) getConfig(key string) (*nginx.Config, error) {
+	cfgm, configExists, err := lbc.configMapLister.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := nginx.NewDefaultConfig()
+	if configExists {
+		cfg = nginx.ParseConfigMap(cfgm)
 	}
+
+	if lbc.defaultBackend != nil {
+		if err := lbc.defaultBackend.UpdateTemplates(cfg.DefaultBackendHTMLTemplate, cfg.DefaultBackendJSONTemplate); err != nil {
+			glog.Errorf("Error updating the default backend templates from ConfigMap %v: %v", key, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// getIngressesForConfig returns the Ingress resources that have to be regenerated
+// when the global configuration changes
+func (lbc *LoadBalancerController) getIngressesForConfig() []*nginx.IngressEx {
+	var ingExes []*nginx.IngressEx
+	for _, ing := range lbc.ingressLister.List() {
+		if !lbc.IsNginxIngress(ing) || !lbc.IsWatchedNamespace(ing.Namespace) {
+			continue
+		}
+		ingEx, err := lbc.createIngress(ing)
+		if err != nil {
+			log.Printf("Error creating Ingress %v/%v: %v, skipping", ing.Namespace, ing.Name, err)
+			continue
+		}
+		ingExes = append(ingExes, ingEx)
+	}
+	return ingExes
 }
 
 // AddSyncQueue enqueues the provided item on the sync queue
@@ -152,14 +315,21 @@ func (lbc *LoadBalancerController) AddSyncQueue(item interface{}) {
 
 func (lbc *LoadBalancerController) syncIng(task queue.Task) {
 	key := task.Key
-	ing, ingExists, err := lbc.ingressLister.GetByKeySafe(key)
+	ing, ingExists, err := lbc.ingressLister.Get(key)
 	if err != nil {
 		lbc.syncQueue.Requeue(task, err)
 		return
 	}
+	if ingExists && !lbc.IsWatchedNamespace(ing.Namespace) {
+		ingExists = false
+	}
 	if !ingExists {
 		log.Printf("Deleting Ingress: %v %v\n", key, ing)
 		lbc.configurator.DeleteIngress(key)
+		if lbc.healthChecker != nil {
+			lbc.healthChecker.Remove(key)
+		}
+		lbc.enqueueIngressesWithoutHost()
 	} else {
 		log.Printf("Adding or Updating Ingress: %v\n", key)
 		ingEx, err := lbc.createIngress(ing)
@@ -176,19 +346,65 @@ func (lbc *LoadBalancerController) syncIng(task queue.Task) {
 	}
 }
 
-func (lbc *LoadBalancerController) getIngressForEndpoints(obj interface{}) []extensions.Ingress {
-	var ings []extensions.Ingress
+// enqueueIngressesWithoutHost enqueues the Ingresses with rules without a host that have no configuration.
+// The deleted Ingress may have had the default server, which one of them gets now.
+func (lbc *LoadBalancerController) enqueueIngressesWithoutHost() {
+	for _, ing := range lbc.ingressLister.List() {
+		if !lbc.IsNginxIngress(ing) || !lbc.IsWatchedNamespace(ing.Namespace) || lbc.configurator.HasIngress(ing) {
+			continue
+		}
+		for _, rule := range ing.Spec.Rules {
+			if rule.IngressRuleValue.HTTP != nil && rule.Host == "" {
+				lbc.syncQueue.Enqueue(ing)
+				break
+			}
+		}
+	}
+}
+
+// recordIngressError logs the error of the configuration of the Ingress rejected by NGINX
+// and records it as a warning event of the Ingress
+func (lbc *LoadBalancerController) recordIngressError(ing *extensions.Ingress, err error) {
+	log.Printf("AddedOrUpdatedWithError Configuration for %v/%v was rejected by NGINX, keeping the last valid one: %v", ing.Namespace, ing.Name, err)
+
+	now := meta_v1.Now()
+	event := &api_v1.Event{
+		ObjectMeta: meta_v1.ObjectMeta{
+			GenerateName: ing.Name + ".",
+			Namespace:    ing.Namespace,
+		},
+		InvolvedObject: api_v1.ObjectReference{
+			Kind:            "Ingress",
+			APIVersion:      "extensions/v1beta1",
+			Namespace:       ing.Namespace,
+			Name:            ing.Name,
+			UID:             ing.UID,
+			ResourceVersion: ing.ResourceVersion,
+		},
+		Reason:         "AddedOrUpdatedWithError",
+		Message:        fmt.Sprintf("Configuration was rejected by NGINX, the last valid one is kept: %v", err),
+		Type:           api_v1.EventTypeWarning,
+		Source:         api_v1.EventSource{Component: "mini-ingress-nginx"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := lbc.client.Core().Events(ing.Namespace).Create(event); err != nil {
+		glog.Errorf("Error recording the event of Ingress %v/%v: %v", ing.Namespace, ing.Name, err)
+	}
+}
+
+func (lbc *LoadBalancerController) getIngressForEndpoints(obj interface{}) []*extensions.Ingress {
 	endp := obj.(*api_v1.Endpoints)
-	svcKey := endp.GetNamespace() + "/" + endp.GetName()
-	svcObj, svcExists, err := lbc.svcLister.GetByKey(svcKey)
+	svc, svcExists, err := lbc.svcLister.Get(endp.GetNamespace(), endp.GetName())
 	if err != nil {
-		log.Printf("error getting service %v from the cache: %v\n", svcKey, err)
-	} else {
-		if svcExists {
-			ings = append(ings, lbc.getIngressesForService(svcObj.(*api_v1.Service))...)
-		}
+		log.Printf("error getting service %v/%v from the cache: %v\n", endp.GetNamespace(), endp.GetName(), err)
+		return nil
 	}
-	return ings
+	if !svcExists {
+		return nil
+	}
+	return lbc.getIngressesForService(svc)
 }
 
 func (lbc *LoadBalancerController) syncEndpoint(task queue.Task) {
@@ -199,6 +415,8 @@ func (lbc *LoadBalancerController) syncEndpoint(task queue.Task) {
 		return
 	}
 
+	lbc.enqueueStreamsForService(key)
+
 	if !endpExists {
 		return
 	}
@@ -207,16 +425,20 @@ func (lbc *LoadBalancerController) syncEndpoint(task queue.Task) {
 
 	var ingExes []*nginx.IngressEx
 
-	for i := range ings {
-		if !lbc.IsNginxIngress(&ings[i]) {
+	for _, ing := range ings {
+		if !lbc.IsNginxIngress(ing) {
+			continue
+		}
+		if !lbc.configurator.HasIngress(ing) {
 			continue
 		}
-		if !lbc.configurator.HasIngress(&ings[i]) {
+		// the upstreams of the service-upstream mode don't depend on the endpoints
+		if isServiceUpstream(ing) {
 			continue
 		}
-		ingEx, err := lbc.createIngress(&ings[i])
+		ingEx, err := lbc.createIngress(ing)
 		if err != nil {
-			log.Printf("Error updating endpoints for %v/%v: %v, skipping", &ings[i].Namespace, &ings[i].Name, err)
+			log.Printf("Error updating endpoints for %v/%v: %v, skipping", ing.Namespace, ing.Name, err)
 			continue
 		}
 		ingExes = append(ingExes, ingEx)
@@ -233,9 +455,10 @@ func (lbc *LoadBalancerController) syncEndpoint(task queue.Task) {
 
 func (lbc *LoadBalancerController) createIngress(ing *extensions.Ingress) (*nginx.IngressEx, error) {
 	ingEx := &nginx.IngressEx{
-		Ingress:      ing,
-		Endpoints:    make(map[string][]string),
-		HealthChecks: make(map[string]*api_v1.Probe),
+		Ingress:       ing,
+		Endpoints:     make(map[string][]string),
+		HealthChecks:  make(map[string]*api_v1.Probe),
+		ExternalNames: make(map[string]string),
 	}
 
 	/**
@@ -245,13 +468,11 @@ func (lbc *LoadBalancerController) createIngress(ing *extensions.Ingress) (*ngin
 	 *	   servicePort: 80
 	 */
 	if ing.Spec.Backend != nil {
-		endps, err := lbc.getEndpointsForIngressBackend(ing.Spec.Backend, ing.Namespace)
-		if err != nil {
-			fmt.Printf("Error retrieving endpoints for the service %v: %v\n", ing.Spec.Backend.ServiceName, err)
-			ingEx.Endpoints[ing.Spec.Backend.ServiceName+ing.Spec.Backend.ServicePort.String()] = []string{}
-		} else {
-			ingEx.Endpoints[ing.Spec.Backend.ServiceName+ing.Spec.Backend.ServicePort.String()] = endps
-		}
+		lbc.setBackendEndpoints(ingEx, ing.Spec.Backend)
+	}
+
+	if backend := nginx.GetMirrorBackend(ing); backend != nil {
+		lbc.setBackendEndpoints(ingEx, backend)
 	}
 
 	validRules := 0
@@ -261,18 +482,8 @@ func (lbc *LoadBalancerController) createIngress(ing *extensions.Ingress) (*ngin
 			continue
 		}
 
-		if rule.Host == "" {
-			return nil, fmt.Errorf("Ingress rule contains empty host")
-		}
-
-		for _, path := range rule.HTTP.Paths {
-			endps, err := lbc.getEndpointsForIngressBackend(&path.Backend, ing.Namespace)
-			if err != nil {
-				log.Printf("Error retrieving endpoints for the service %v: %v\n", path.Backend.ServiceName, err)
-				ingEx.Endpoints[path.Backend.ServiceName+path.Backend.ServicePort.String()] = []string{}
-			} else {
-				ingEx.Endpoints[path.Backend.ServiceName+path.Backend.ServicePort.String()] = endps
-			}
+		for i := range rule.HTTP.Paths {
+			lbc.setBackendEndpoints(ingEx, &rule.HTTP.Paths[i].Backend)
 		}
 		validRules++
 	}
@@ -280,9 +491,169 @@ func (lbc *LoadBalancerController) createIngress(ing *extensions.Ingress) (*ngin
 		return nil, fmt.Errorf("Ingress contains no valid rules")
 	}
 
+	if lbc.healthChecker != nil {
+		// the ClusterIPs of the services in the service-upstream mode are load balanced by kube-proxy
+		if isServiceUpstream(ing) {
+			lbc.healthChecker.Remove(ing.Namespace + "/" + ing.Name)
+		} else {
+			lbc.updateHealthChecks(ingEx)
+		}
+	}
+
+	if name, exists := ing.Annotations[customErrorPagesAnnotation]; exists {
+		ingEx.ErrorPages = lbc.getConfigMapData(ing.Namespace, name)
+	}
+
+	if name, exists := ing.Annotations[fastCGIParamsAnnotation]; exists {
+		ingEx.FastCGIParams = lbc.getConfigMapData(ing.Namespace, name)
+	}
+
+	ingEx.BackendProtocols = make(map[string]string)
+	for _, backend := range getIngressBackends(ing) {
+		if protocol := lbc.getBackendProtocol(backend, ing.Namespace); protocol != "" {
+			ingEx.BackendProtocols[backend.ServiceName+backend.ServicePort.String()] = protocol
+		}
+	}
+
+	ingEx.TLSSecrets = make(map[string]*api_v1.Secret)
+	for _, tls := range ing.Spec.TLS {
+		secret, err := lbc.getTLSSecret(ing.Namespace, tls.SecretName)
+		if err != nil {
+			log.Printf("Ingress %v/%v: Error retrieving TLS secret %v: %v", ing.Namespace, ing.Name, tls.SecretName, err)
+			continue
+		}
+		ingEx.TLSSecrets[tls.SecretName] = secret
+	}
+
 	return ingEx, nil
 }
 
+// getTLSSecret returns the secret if it holds a certificate and a key
+func (lbc *LoadBalancerController) getTLSSecret(namespace string, name string) (*api_v1.Secret, error) {
+	secret, exists, err := lbc.secretLister.Get(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("secret %v/%v doesn't exist", namespace, name)
+	}
+	if _, exists := secret.Data[api_v1.TLSCertKey]; !exists {
+		return nil, fmt.Errorf("secret doesn't have the %v key", api_v1.TLSCertKey)
+	}
+	if _, exists := secret.Data[api_v1.TLSPrivateKeyKey]; !exists {
+		return nil, fmt.Errorf("secret doesn't have the %v key", api_v1.TLSPrivateKeyKey)
+	}
+	return secret, nil
+}
+
+// setBackendEndpoints sets the addresses the upstream of the backend proxies to,
+// or the external name of an ExternalName service, which is resolved by NGINX
+func (lbc *LoadBalancerController) setBackendEndpoints(ingEx *nginx.IngressEx, backend *extensions.IngressBackend) {
+	key := backend.ServiceName + backend.ServicePort.String()
+
+	externalName, err := lbc.getExternalNameForIngressBackend(backend, ingEx.Ingress.Namespace)
+	if err != nil {
+		log.Printf("Error retrieving the external name of the service %v: %v", backend.ServiceName, err)
+		ingEx.Endpoints[key] = []string{}
+		return
+	}
+	if externalName != "" {
+		ingEx.ExternalNames[key] = externalName
+		ingEx.Endpoints[key] = []string{}
+		return
+	}
+
+	endps, err := lbc.getUpstreamServersForIngressBackend(ingEx.Ingress, backend)
+	if err != nil {
+		log.Printf("Error retrieving endpoints for the service %v: %v", backend.ServiceName, err)
+		endps = []string{}
+	}
+	ingEx.Endpoints[key] = endps
+}
+
+// getExternalNameForIngressBackend returns the external name and port of the service of the backend
+// if it's an ExternalName service, e.g. api.example.com:443. A service that doesn't exist has no external name.
+func (lbc *LoadBalancerController) getExternalNameForIngressBackend(backend *extensions.IngressBackend, namespace string) (string, error) {
+	svc, err := lbc.getServiceForIngressBackend(backend, namespace)
+	if k8s_errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if svc.Spec.Type != api_v1.ServiceTypeExternalName {
+		return "", nil
+	}
+
+	port := int32(backend.ServicePort.IntValue())
+	for i := range svc.Spec.Ports {
+		if servicePortMatches(&svc.Spec.Ports[i], backend.ServicePort) {
+			port = svc.Spec.Ports[i].Port
+			break
+		}
+	}
+	if port == 0 {
+		return "", fmt.Errorf("No port %v in service %s", backend.ServicePort.String(), svc.Name)
+	}
+
+	return fmt.Sprintf("%v:%v", svc.Spec.ExternalName, port), nil
+}
+
+// getIngressBackends returns the backends of the rules and the default backend of the Ingress
+func getIngressBackends(ing *extensions.Ingress) []*extensions.IngressBackend {
+	var backends []*extensions.IngressBackend
+	if ing.Spec.Backend != nil {
+		backends = append(backends, ing.Spec.Backend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.IngressRuleValue.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			backends = append(backends, &rule.HTTP.Paths[i].Backend)
+		}
+	}
+	return backends
+}
+
+// getBackendProtocol returns the protocol inferred from the name of the service port of the backend
+func (lbc *LoadBalancerController) getBackendProtocol(backend *extensions.IngressBackend, namespace string) string {
+	svc, err := lbc.getServiceForIngressBackend(backend, namespace)
+	if err != nil {
+		return ""
+	}
+	for i := range svc.Spec.Ports {
+		if servicePortMatches(&svc.Spec.Ports[i], backend.ServicePort) {
+			return nginx.InferBackendProtocol(svc.Spec.Ports[i].Name)
+		}
+	}
+	return ""
+}
+
+// getConfigMapData returns the data of a ConfigMap referenced by an Ingress, e.g. its custom error pages
+func (lbc *LoadBalancerController) getConfigMapData(namespace string, name string) map[string]string {
+	key := namespace + "/" + name
+	if lbc.configMapLister.Indexer == nil {
+		return nil
+	}
+
+	cfgm, exists, err := lbc.configMapLister.Get(key)
+	if err != nil {
+		log.Printf("Error getting ConfigMap %v from the cache: %v", key, err)
+		return nil
+	}
+	if !exists {
+		log.Printf("ConfigMap %v doesn't exist", key)
+		return nil
+	}
+
+	data := make(map[string]string)
+	for k, v := range cfgm.Data {
+		data[k] = v
+	}
+	return data
+}
+
 func (lbc *LoadBalancerController) getEndpointsForIngressBackend(backend *extensions.IngressBackend, namespace string) ([]string, error) {
 	svc, err := lbc.getServiceForIngressBackend(backend, namespace)
 	if err != nil {
@@ -305,26 +676,25 @@ func (lbc *LoadBalancerController) getEndpointsForIngressBackend(backend *extens
 }
 
 func (lbc *LoadBalancerController) getServiceForIngressBackend(backend *extensions.IngressBackend, namespace string) (*api_v1.Service, error) {
-	svcKey := namespace + "/" + backend.ServiceName
-	svcObj, svcExists, err := lbc.svcLister.GetByKey(svcKey)
+	svc, svcExists, err := lbc.svcLister.Get(namespace, backend.ServiceName)
 	if err != nil {
 		return nil, err
 	}
 
 	if svcExists {
-		return svcObj.(*api_v1.Service), nil
+		return svc, nil
 	}
 
-	return nil, fmt.Errorf("service %s doesn't exist", svcKey)
+	return nil, k8s_errors.NewNotFound(api_v1.Resource("services"), backend.ServiceName)
 }
 
-func (lbc *LoadBalancerController) getEndpointsForPort(endps api_v1.Endpoints, ingSvcPort intstr.IntOrString, svc *api_v1.Service) ([]string, error) {
+func (lbc *LoadBalancerController) getEndpointsForPort(endps *api_v1.Endpoints, ingSvcPort intstr.IntOrString, svc *api_v1.Service) ([]string, error) {
 	var targetPort int32
 	var err error
 	found := false
 
 	for _, port := range svc.Spec.Ports {
-		if (ingSvcPort.Type == intstr.Int && port.Port == int32(ingSvcPort.IntValue())) || (ingSvcPort.Type == intstr.String && port.Name == ingSvcPort.String()) {
+		if servicePortMatches(&port, ingSvcPort) {
 			targetPort, err = lbc.getTargetPort(&port, svc)
 			if err != nil {
 				return nil, fmt.Errorf("Error determining target port for port %v in Ingress: %v", ingSvcPort, err)
@@ -354,6 +724,10 @@ func (lbc *LoadBalancerController) getEndpointsForPort(endps api_v1.Endpoints, i
 	return nil, fmt.Errorf("No endpoints for target port %v in service %s", targetPort, svc.Name)
 }
 
+func servicePortMatches(port *api_v1.ServicePort, ingSvcPort intstr.IntOrString) bool {
+	return (ingSvcPort.Type == intstr.Int && port.Port == int32(ingSvcPort.IntValue())) || (ingSvcPort.Type == intstr.String && port.Name == ingSvcPort.String())
+}
+
 func (lbc *LoadBalancerController) getTargetPort(svcPort *api_v1.ServicePort, svc *api_v1.Service) (int32, error) {
 	if (svcPort.TargetPort == intstr.IntOrString{}) {
 		return svcPort.Port, nil
@@ -363,16 +737,12 @@ func (lbc *LoadBalancerController) getTargetPort(svcPort *api_v1.ServicePort, sv
 		return int32(svcPort.TargetPort.IntValue()), nil
 	}
 
-	pods, err := lbc.client.Core().Pods(svc.Namespace).List(meta_v1.ListOptions{LabelSelector: labels.Set(svc.Spec.Selector).String()})
-	if err != nil {
-		return 0, fmt.Errorf("Error getting pod information: %v", err)
-	}
-
-	if len(pods.Items) == 0 {
+	pods := lbc.podLister.ListBySelector(svc.Namespace, labels.SelectorFromSet(svc.Spec.Selector))
+	if len(pods) == 0 {
 		return 0, fmt.Errorf("No pods of service %s", svc.Name)
 	}
 
-	pod := &pods.Items[0]
+	pod := pods[0]
 
 	portNum, err := utils.FindPort(pod, svcPort)
 	if err != nil {
@@ -389,7 +759,10 @@ func (lbc *LoadBalancerController) Stop() {
 	lbc.syncQueue.Shutdown()
 }
 
-func (lbc *LoadBalancerController) getIngressesForService(svc *api_v1.Service) []extensions.Ingress {
+func (lbc *LoadBalancerController) getIngressesForService(svc *api_v1.Service) []*extensions.Ingress {
+	if !lbc.IsWatchedNamespace(svc.Namespace) {
+		return nil
+	}
 	ings, err := lbc.ingressLister.GetServiceIngress(svc)
 	if err != nil {
 		glog.V(3).Infof("ignoring service %v: %v", svc.Name, err)
@@ -398,13 +771,46 @@ func (lbc *LoadBalancerController) getIngressesForService(svc *api_v1.Service) [
 	return ings
 }
 
-// EnqueueIngressForService enqueues the ingress for the given service
+// EnqueueIngressForConfigMap enqueues the ingresses that refer to the ConfigMap for their custom error pages
+// or FastCGI params
+func (lbc *LoadBalancerController) EnqueueIngressForConfigMap(cfgm *api_v1.ConfigMap) {
+	for _, ing := range lbc.ingressLister.ListByNamespace(cfgm.Namespace) {
+		if !lbc.IsWatchedNamespace(ing.Namespace) ||
+			(ing.Annotations[customErrorPagesAnnotation] != cfgm.Name && ing.Annotations[fastCGIParamsAnnotation] != cfgm.Name) {
+			continue
+		}
+		if !lbc.configurator.HasIngress(ing) {
+			continue
+		}
+		lbc.syncQueue.Enqueue(ing)
+	}
+}
+
+// EnqueueIngressForSecret enqueues the ingresses that refer to the secret for TLS
+func (lbc *LoadBalancerController) EnqueueIngressForSecret(secret *api_v1.Secret) {
+	for _, ing := range lbc.ingressLister.ListByNamespace(secret.Namespace) {
+		if !lbc.IsWatchedNamespace(ing.Namespace) || !lbc.configurator.HasIngress(ing) {
+			continue
+		}
+		for _, tls := range ing.Spec.TLS {
+			if tls.SecretName == secret.Name {
+				log.Printf("Secret %v/%v of Ingress %v changed, syncing", secret.Namespace, secret.Name, ing.Name)
+				lbc.syncQueue.Enqueue(ing)
+				break
+			}
+		}
+	}
+}
+
+// EnqueueIngressForService enqueues the ingress and the stream services for the given service
 func (lbc *LoadBalancerController) EnqueueIngressForService(svc *api_v1.Service) {
+	lbc.enqueueStreamsForService(svc.Namespace + "/" + svc.Name)
+
 	ings := lbc.getIngressesForService(svc)
 	for _, ing := range ings {
-		if !lbc.configurator.HasIngress(&ing) {
+		if !lbc.configurator.HasIngress(ing) {
 			continue
 		}
-		lbc.syncQueue.Enqueue(&ing)
+		lbc.syncQueue.Enqueue(ing)
 	}
 }
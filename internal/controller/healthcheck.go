@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/healthcheck"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/nginx"
+	api_v1 "k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const healthChecksAnnotation = "nginx.org/health-checks"
+
+// updateHealthChecks registers the endpoints of the Ingress backends with the health checker
+// and removes the endpoints that failed the health checks from the Ingress
+func (lbc *LoadBalancerController) updateHealthChecks(ingEx *nginx.IngressEx) {
+	ing := ingEx.Ingress
+	key := ing.Namespace + "/" + ing.Name
+
+	enabled, exists, err := nginx.GetMapKeyAsBool(ing.Annotations, healthChecksAnnotation)
+	if err != nil {
+		log.Printf("Ingress %v: Invalid value for the %v annotation: %v", key, healthChecksAnnotation, err)
+	}
+	if exists && !enabled {
+		lbc.healthChecker.Remove(key)
+		return
+	}
+
+	var backends []*extensions.IngressBackend
+	if ing.Spec.Backend != nil {
+		backends = append(backends, ing.Spec.Backend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.IngressRuleValue.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			backends = append(backends, &rule.HTTP.Paths[i].Backend)
+		}
+	}
+
+	var hcBackends []healthcheck.Backend
+	seen := make(map[string]bool)
+	for _, backend := range backends {
+		backendKey := backend.ServiceName + backend.ServicePort.String()
+		if seen[backendKey] {
+			continue
+		}
+		seen[backendKey] = true
+
+		probes := lbc.getHealthChecksForIngressBackend(backend, ing.Namespace)
+		if len(probes) == 0 {
+			continue
+		}
+
+		var healthy []string
+		for _, endp := range ingEx.Endpoints[backendKey] {
+			probe := probes[endp]
+			if probe == nil {
+				healthy = append(healthy, endp)
+				continue
+			}
+
+			ingEx.HealthChecks[endp] = probe
+			hcBackends = append(hcBackends, healthcheck.Backend{Endpoints: []string{endp}, Probe: probe})
+			if lbc.healthChecker.IsHealthy(endp, probe) {
+				healthy = append(healthy, endp)
+			}
+		}
+		ingEx.Endpoints[backendKey] = healthy
+	}
+
+	lbc.healthChecker.Update(key, hcBackends)
+}
+
+// getHealthChecksForIngressBackend returns the HTTP readiness probes of the endpoints of the backend
+// by endpoint address, with their ports resolved to numbers. Every endpoint is checked with the probe
+// of its own pod, so the pods of a service may have different probes, e.g. during a rollout.
+func (lbc *LoadBalancerController) getHealthChecksForIngressBackend(backend *extensions.IngressBackend, namespace string) map[string]*api_v1.Probe {
+	svc, err := lbc.getServiceForIngressBackend(backend, namespace)
+	if err != nil {
+		return nil
+	}
+
+	var svcPort *api_v1.ServicePort
+	for i := range svc.Spec.Ports {
+		if servicePortMatches(&svc.Spec.Ports[i], backend.ServicePort) {
+			svcPort = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if svcPort == nil {
+		return nil
+	}
+
+	endps, err := lbc.endpointLister.GetServiceEndpoints(svc)
+	if err != nil {
+		return nil
+	}
+
+	probes := make(map[string]*api_v1.Probe)
+	for _, subset := range endps.Subsets {
+		for _, address := range subset.Addresses {
+			if address.TargetRef == nil || address.TargetRef.Kind != "Pod" {
+				continue
+			}
+			pod, exists, err := lbc.podLister.Get(svc.Namespace, address.TargetRef.Name)
+			if err != nil || !exists {
+				continue
+			}
+			probe := findProbeForPod(pod, svcPort)
+			if probe == nil {
+				continue
+			}
+			for _, port := range subset.Ports {
+				probes[fmt.Sprintf("%v:%v", address.IP, port.Port)] = probe
+			}
+		}
+	}
+	return probes
+}
+
+func findProbeForPod(pod *api_v1.Pod, svcPort *api_v1.ServicePort) *api_v1.Probe {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if !containerPortMatches(&port, svcPort) {
+				continue
+			}
+			// only HTTP readiness probes can be checked from the controller
+			if container.ReadinessProbe == nil || container.ReadinessProbe.HTTPGet == nil {
+				continue
+			}
+
+			probe := container.ReadinessProbe.DeepCopy()
+			if probe.HTTPGet.Port.Type == intstr.String {
+				for _, p := range container.Ports {
+					if p.Name == probe.HTTPGet.Port.StrVal {
+						probe.HTTPGet.Port = intstr.FromInt(int(p.ContainerPort))
+					}
+				}
+				if probe.HTTPGet.Port.Type == intstr.String {
+					return nil
+				}
+			}
+			return probe
+		}
+	}
+
+	return nil
+}
+
+func containerPortMatches(containerPort *api_v1.ContainerPort, svcPort *api_v1.ServicePort) bool {
+	if containerPort.Protocol != svcPort.Protocol {
+		return false
+	}
+	if (svcPort.TargetPort == intstr.IntOrString{}) {
+		return containerPort.ContainerPort == svcPort.Port
+	}
+	if svcPort.TargetPort.Type == intstr.Int {
+		return containerPort.ContainerPort == int32(svcPort.TargetPort.IntValue())
+	}
+	return containerPort.Name == svcPort.TargetPort.StrVal
+}
+
+// enqueueIngressByKey enqueues the Ingress with the given key if it still exists
+func (lbc *LoadBalancerController) enqueueIngressByKey(key string) {
+	ing, exists, err := lbc.ingressLister.Get(key)
+	if err != nil || !exists {
+		return
+	}
+	lbc.syncQueue.Enqueue(ing)
+}
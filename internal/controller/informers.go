@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/nginx"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/utils"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerFactory creates the shared informers of the controller, starts them together
+// and waits for their caches to be synced
+type informerFactory struct {
+	resync    time.Duration
+	informers []cache.SharedIndexInformer
+}
+
+// newInformer creates an informer of the resource in the namespace, empty for all namespaces,
+// indexed by namespace and the extra indexers
+func (f *informerFactory) newInformer(client cache.Getter, resource string, namespace string,
+	objType runtime.Object, indexers cache.Indexers) cache.SharedIndexInformer {
+	allIndexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	for name, indexFunc := range indexers {
+		allIndexers[name] = indexFunc
+	}
+
+	informer := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(client, resource, namespace, fields.Everything()),
+		objType,
+		f.resync,
+		allIndexers,
+	)
+	f.informers = append(f.informers, informer)
+	return informer
+}
+
+// Start runs the informers
+func (f *informerFactory) Start(stopCh <-chan struct{}) {
+	for _, informer := range f.informers {
+		go informer.Run(stopCh)
+	}
+}
+
+// WaitForCacheSync waits until the caches of the informers are synced.
+// It returns false if stopCh is closed first.
+func (f *informerFactory) WaitForCacheSync(stopCh <-chan struct{}) bool {
+	var synced []cache.InformerSynced
+	for _, informer := range f.informers {
+		synced = append(synced, informer.HasSynced)
+	}
+	return cache.WaitForCacheSync(stopCh, synced...)
+}
+
+// ingressIndexers indexes the Ingresses by the services of their backends
+var ingressIndexers = cache.Indexers{utils.ServiceIndex: ingressServiceIndexFunc}
+
+// ingressServiceIndexFunc indexes an Ingress by the <namespace>/<name> of the services of its backends,
+// including its mirror
+func ingressServiceIndexFunc(obj interface{}) ([]string, error) {
+	ing, ok := obj.(*extensions.Ingress)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not an Ingress", obj)
+	}
+
+	backends := getIngressBackends(ing)
+	if mirror := nginx.GetMirrorBackend(ing); mirror != nil {
+		backends = append(backends, mirror)
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for _, backend := range backends {
+		key := ing.Namespace + "/" + backend.ServiceName
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"log"
+
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchNamespace returns the namespace the informers watch: the namespace of the controller
+// when it is the only one, all namespaces otherwise
+func (lbc *LoadBalancerController) watchNamespace() string {
+	if len(lbc.namespaces) == 1 && lbc.namespaceSelector == nil {
+		return lbc.namespaces[0]
+	}
+	return ""
+}
+
+// WatchNamespace returns the namespace the informers watch, empty for all namespaces
+func (lbc *LoadBalancerController) WatchNamespace() string {
+	return lbc.watchNamespace()
+}
+
+// IsWatchedNamespace checks if the resources of the namespace are handled by the controller:
+// the namespace must be in the list of namespaces, if any, and match the namespace selector, if any
+func (lbc *LoadBalancerController) IsWatchedNamespace(namespace string) bool {
+	if len(lbc.namespaces) > 0 {
+		listed := false
+		for _, ns := range lbc.namespaces {
+			if ns == namespace {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			return false
+		}
+	}
+
+	if lbc.namespaceSelector == nil {
+		return true
+	}
+
+	lbc.selectedNamespacesLock.Lock()
+	defer lbc.selectedNamespacesLock.Unlock()
+	return lbc.selectedNamespaces[namespace]
+}
+
+// AddNamespaceHandler adds the handler for namespaces to the controller.
+// Namespaces are only watched with a namespace selector.
+func (lbc *LoadBalancerController) AddNamespaceHandler(handlers cache.ResourceEventHandlerFuncs) {
+	if lbc.namespaceSelector == nil {
+		return
+	}
+	informer := lbc.informers.newInformer(lbc.client.Core().RESTClient(), "namespaces", "", &api_v1.Namespace{}, nil)
+	informer.AddEventHandler(handlers)
+}
+
+// UpdateNamespace checks if the namespace matches the namespace selector.
+// When the namespace starts or stops matching, its Ingresses are enqueued to be added or removed.
+func (lbc *LoadBalancerController) UpdateNamespace(ns *api_v1.Namespace) {
+	lbc.setNamespaceSelected(ns.Name, lbc.namespaceSelector.Matches(labels.Set(ns.Labels)))
+}
+
+// DeleteNamespace removes the Ingresses of the namespace
+func (lbc *LoadBalancerController) DeleteNamespace(ns *api_v1.Namespace) {
+	lbc.setNamespaceSelected(ns.Name, false)
+}
+
+func (lbc *LoadBalancerController) setNamespaceSelected(namespace string, selected bool) {
+	lbc.selectedNamespacesLock.Lock()
+	changed := lbc.selectedNamespaces[namespace] != selected
+	if selected {
+		lbc.selectedNamespaces[namespace] = true
+	} else {
+		delete(lbc.selectedNamespaces, namespace)
+	}
+	lbc.selectedNamespacesLock.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if selected {
+		log.Printf("Namespace %v matches the namespace selector, adding its Ingresses", namespace)
+	} else {
+		log.Printf("Namespace %v no longer matches the namespace selector, removing its Ingresses", namespace)
+	}
+	lbc.enqueueIngressesForNamespace(namespace)
+}
+
+// enqueueIngressesForNamespace enqueues the Ingresses of the namespace.
+// syncIng removes the Ingresses of the namespaces that aren't watched.
+func (lbc *LoadBalancerController) enqueueIngressesForNamespace(namespace string) {
+	if lbc.ingressLister.Indexer == nil {
+		return
+	}
+	for _, ing := range lbc.ingressLister.ListByNamespace(namespace) {
+		if !lbc.IsNginxIngress(ing) {
+			continue
+		}
+		lbc.syncQueue.Enqueue(ing)
+	}
+}
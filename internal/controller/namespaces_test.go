@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/queue"
+	extensions "k8s.io/api/extensions/v1beta1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestIsWatchedNamespace(t *testing.T) {
+	selector := labels.SelectorFromSet(labels.Set{"ingress": "mini-nginx"})
+
+	tests := []struct {
+		msg        string
+		namespaces []string
+		selector   labels.Selector
+		selected   []string
+		expected   map[string]bool
+	}{
+		{
+			msg:      "all namespaces",
+			expected: map[string]bool{"default": true, "tea": true},
+		},
+		{
+			msg:        "listed namespaces",
+			namespaces: []string{"default"},
+			expected:   map[string]bool{"default": true, "tea": false},
+		},
+		{
+			msg:      "namespaces selected among all namespaces",
+			selector: selector,
+			selected: []string{"tea"},
+			expected: map[string]bool{"default": false, "tea": true},
+		},
+		{
+			msg:        "namespaces selected among the listed namespaces",
+			namespaces: []string{"default", "coffee"},
+			selector:   selector,
+			selected:   []string{"tea", "coffee"},
+			expected:   map[string]bool{"default": false, "tea": false, "coffee": true},
+		},
+	}
+
+	for _, test := range tests {
+		lbc := &LoadBalancerController{
+			namespaces:         test.namespaces,
+			namespaceSelector:  test.selector,
+			selectedNamespaces: make(map[string]bool),
+		}
+		for _, ns := range test.selected {
+			lbc.selectedNamespaces[ns] = true
+		}
+
+		for ns, expected := range test.expected {
+			if watched := lbc.IsWatchedNamespace(ns); watched != expected {
+				t.Errorf("IsWatchedNamespace(%q) returned %v for the case of %s, expected %v", ns, watched, test.msg, expected)
+			}
+		}
+	}
+}
+
+func TestSetNamespaceSelected(t *testing.T) {
+	var lock sync.Mutex
+	var synced []string
+	lbc := &LoadBalancerController{
+		namespaceSelector:  labels.SelectorFromSet(labels.Set{"ingress": "mini-nginx"}),
+		selectedNamespaces: make(map[string]bool),
+		ingressClass:       "mini-ingress-nginx",
+	}
+	lbc.ingressLister.Indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, ing := range []struct{ namespace, name, class string }{
+		{"tea", "green", ""},
+		{"tea", "black", "mini-ingress-nginx"},
+		{"tea", "other", "other-class"},
+		{"coffee", "espresso", ""},
+	} {
+		lbc.ingressLister.Add(&extensions.Ingress{ObjectMeta: meta_v1.ObjectMeta{
+			Namespace:   ing.namespace,
+			Name:        ing.name,
+			Annotations: map[string]string{ingressClassKey: ing.class},
+		}})
+	}
+
+	tests := []struct {
+		msg            string
+		selected       bool
+		expectedSynced []string
+	}{
+		{"namespace that starts matching", true, []string{"tea/black", "tea/green"}},
+		{"namespace that still matches", true, nil},
+		{"namespace that stops matching", false, []string{"tea/black", "tea/green"}},
+		{"namespace that still doesn't match", false, nil},
+	}
+
+	for _, test := range tests {
+		lbc.syncQueue = queue.NewTaskQueue(func(task queue.Task) {
+			lock.Lock()
+			synced = append(synced, task.Key)
+			lock.Unlock()
+		})
+
+		lbc.setNamespaceSelected("tea", test.selected)
+		if watched := lbc.IsWatchedNamespace("tea"); watched != test.selected {
+			t.Errorf("setNamespaceSelected() made the namespace watched: %v for the case of %s, expected %v", watched, test.msg, test.selected)
+		}
+
+		// the queue syncs the enqueued Ingresses before it shuts down
+		stopCh := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			lbc.syncQueue.Run(time.Hour, stopCh)
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		close(stopCh)
+		lbc.syncQueue.Shutdown()
+		<-done
+
+		lock.Lock()
+		sort.Strings(synced)
+		if !reflect.DeepEqual(synced, test.expectedSynced) {
+			t.Errorf("setNamespaceSelected() enqueued %v for the case of %s, expected %v", synced, test.msg, test.expectedSynced)
+		}
+		synced = nil
+		lock.Unlock()
+	}
+}
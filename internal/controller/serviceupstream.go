@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/nginx"
+	api_v1 "k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+)
+
+const serviceUpstreamAnnotation = "nginx.org/service-upstream"
+
+// isServiceUpstream reports whether the upstreams of the Ingress proxy to the ClusterIPs of the services
+// instead of their endpoints
+func isServiceUpstream(ing *extensions.Ingress) bool {
+	enabled, _, err := nginx.GetMapKeyAsBool(ing.Annotations, serviceUpstreamAnnotation)
+	if err != nil {
+		log.Printf("Ingress %v/%v: Invalid value for the %v annotation: %v", ing.Namespace, ing.Name, serviceUpstreamAnnotation, err)
+	}
+	return enabled
+}
+
+// getUpstreamServersForIngressBackend returns the addresses the upstream of the backend proxies to:
+// the ClusterIP of the service for the Ingresses in the service-upstream mode, otherwise its endpoints
+func (lbc *LoadBalancerController) getUpstreamServersForIngressBackend(ing *extensions.Ingress, backend *extensions.IngressBackend) ([]string, error) {
+	if isServiceUpstream(ing) {
+		return lbc.getClusterIPForIngressBackend(backend, ing.Namespace)
+	}
+	return lbc.getEndpointsForIngressBackend(backend, ing.Namespace)
+}
+
+func (lbc *LoadBalancerController) getClusterIPForIngressBackend(backend *extensions.IngressBackend, namespace string) ([]string, error) {
+	svc, err := lbc.getServiceForIngressBackend(backend, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == api_v1.ClusterIPNone {
+		return nil, fmt.Errorf("service %v/%v has no ClusterIP", namespace, svc.Name)
+	}
+
+	for _, port := range svc.Spec.Ports {
+		if servicePortMatches(&port, backend.ServicePort) {
+			return []string{fmt.Sprintf("%v:%v", svc.Spec.ClusterIP, port.Port)}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No port %v in service %s", backend.ServicePort, svc.Name)
+}
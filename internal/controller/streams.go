@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"log"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/nginx"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/queue"
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/utils"
+	"github.com/golang/glog"
+	api_v1 "k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IsStreamConfigMap checks if the ConfigMap is the one holding the TCP or the UDP services
+func (lbc *LoadBalancerController) IsStreamConfigMap(cfgm *api_v1.ConfigMap) bool {
+	return lbc.isStreamConfigMapKey(cfgm.Namespace + "/" + cfgm.Name)
+}
+
+func (lbc *LoadBalancerController) isStreamConfigMapKey(key string) bool {
+	return (lbc.tcpServicesConfigMap != "" && key == lbc.tcpServicesConfigMap) ||
+		(lbc.udpServicesConfigMap != "" && key == lbc.udpServicesConfigMap)
+}
+
+// syncStreams regenerates the stream services from both the TCP and the UDP services ConfigMaps,
+// as they share the stream block of the NGINX configuration
+func (lbc *LoadBalancerController) syncStreams(task queue.Task) {
+	streams, err := lbc.getStreams()
+	if err != nil {
+		lbc.syncQueue.Requeue(task, err)
+		return
+	}
+
+	if err := lbc.configurator.UpdateStreams(streams); err != nil {
+		glog.Errorf("Error updating the stream services: %v", err)
+	} else {
+		log.Printf("Updated %v stream services", len(streams))
+	}
+}
+
+// getStreams returns the stream services of the TCP and the UDP services ConfigMaps with their endpoints
+func (lbc *LoadBalancerController) getStreams() ([]nginx.StreamServiceEx, error) {
+	var services []nginx.StreamService
+	for _, cfgm := range []struct {
+		key      string
+		protocol string
+	}{
+		{lbc.tcpServicesConfigMap, nginx.StreamProtocolTCP},
+		{lbc.udpServicesConfigMap, nginx.StreamProtocolUDP},
+	} {
+		if cfgm.key == "" {
+			continue
+		}
+		cm, exists, err := lbc.configMapLister.Get(cfgm.key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		services = append(services, nginx.ParseStreamServices(cm, cfgm.protocol)...)
+	}
+
+	var streams []nginx.StreamServiceEx
+	referenced := make(map[string]bool)
+	for _, svc := range services {
+		referenced[svc.Namespace+"/"+svc.ServiceName] = true
+
+		backend := &extensions.IngressBackend{
+			ServiceName: svc.ServiceName,
+			ServicePort: svc.ServicePort,
+		}
+		endps, err := lbc.getEndpointsForIngressBackend(backend, svc.Namespace)
+		if err != nil {
+			log.Printf("Error retrieving endpoints for the %v service %v/%v: %v", svc.Protocol, svc.Namespace, svc.ServiceName, err)
+		}
+		streams = append(streams, nginx.StreamServiceEx{
+			StreamService: svc,
+			Endpoints:     endps,
+		})
+	}
+
+	lbc.streamServicesLock.Lock()
+	lbc.streamServices = referenced
+	lbc.streamServicesLock.Unlock()
+
+	return streams, nil
+}
+
+// enqueueStreamsForService enqueues the stream services when they refer to the service,
+// the key of the service being <namespace>/<name> like the key of its endpoints
+func (lbc *LoadBalancerController) enqueueStreamsForService(key string) {
+	lbc.streamServicesLock.Lock()
+	referenced := lbc.streamServices[key]
+	lbc.streamServicesLock.Unlock()
+
+	if !referenced {
+		return
+	}
+
+	cfgmKey := lbc.tcpServicesConfigMap
+	if cfgmKey == "" {
+		cfgmKey = lbc.udpServicesConfigMap
+	}
+	ns, name, err := utils.ParseNamespaceName(cfgmKey)
+	if err != nil {
+		return
+	}
+	lbc.syncQueue.Enqueue(&api_v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+		},
+	})
+}
@@ -0,0 +1,158 @@
+// Package defaultbackend implements the server behind the upstreams of the services
+// without endpoints. It responds with 503 and names the Ingress and the service.
+package defaultbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	html_template "html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	text_template "text/template"
+)
+
+// DefaultHTMLTemplate is the default template of the HTML responses
+const DefaultHTMLTemplate = `<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<center><h1>{{.Status}} {{.StatusText}}</h1></center>
+<center>{{.Message}}</center>
+</body>
+</html>
+`
+
+// DefaultJSONTemplate is the default template of the JSON responses
+const DefaultJSONTemplate = `{"status": {{.Status}}, "message": {{json .Message}}, "ingress": {{json .Ingress}}, "service": {{json .Service}}}
+`
+
+// Response holds the data the response templates are executed with
+type Response struct {
+	Status     int
+	StatusText string
+	Message    string
+	Ingress    string
+	Service    string
+	Host       string
+	URI        string
+}
+
+// Server responds to the requests proxied to the services without endpoints
+type Server struct {
+	mu           sync.RWMutex
+	htmlTemplate *html_template.Template
+	jsonTemplate *text_template.Template
+}
+
+// NewServer creates a Server with the default templates
+func NewServer() *Server {
+	s := &Server{}
+	if err := s.UpdateTemplates(DefaultHTMLTemplate, DefaultJSONTemplate); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// UpdateTemplates replaces the templates of the responses.
+// Empty templates are replaced with the defaults.
+func (s *Server) UpdateTemplates(htmlTemplate string, jsonTemplate string) error {
+	if htmlTemplate == "" {
+		htmlTemplate = DefaultHTMLTemplate
+	}
+	if jsonTemplate == "" {
+		jsonTemplate = DefaultJSONTemplate
+	}
+
+	htmlTmpl, err := html_template.New("html").Parse(htmlTemplate)
+	if err != nil {
+		return err
+	}
+	jsonTmpl, err := text_template.New("json").Funcs(text_template.FuncMap{"json": toJSON}).Parse(jsonTemplate)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.htmlTemplate = htmlTmpl
+	s.jsonTemplate = jsonTmpl
+	return nil
+}
+
+// ListenAndServe serves the responses on the given address
+func (s *Server) ListenAndServe(addr string) error {
+	log.Printf("Serving the default backend on %v", addr)
+	return http.ListenAndServe(addr, s)
+}
+
+// ServeHTTP responds with 503 in HTML or JSON, depending on the Accept header of the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := Response{
+		Status:     http.StatusServiceUnavailable,
+		StatusText: http.StatusText(http.StatusServiceUnavailable),
+		Ingress:    r.Header.Get("X-Ingress"),
+		Service:    r.Header.Get("X-Service"),
+		Host:       r.Host,
+		URI:        r.URL.RequestURI(),
+	}
+	resp.Message = "The service has no available endpoints."
+	if resp.Service != "" {
+		resp.Message = "Service " + resp.Service + " of Ingress " + resp.Ingress + " has no available endpoints."
+	}
+
+	var body bytes.Buffer
+	var err error
+	contentType := "text/html; charset=utf-8"
+
+	s.mu.RLock()
+	if prefersJSON(r.Header.Get("Accept")) {
+		contentType = "application/json"
+		err = s.jsonTemplate.Execute(&body, resp)
+	} else {
+		err = s.htmlTemplate.Execute(&body, resp)
+	}
+	s.mu.RUnlock()
+
+	if err != nil {
+		log.Printf("Error executing the default backend template: %v", err)
+		http.Error(w, resp.Message, resp.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(resp.Status)
+	w.Write(body.Bytes())
+}
+
+// prefersJSON reports whether the Accept header ranks application/json above text/html
+func prefersJSON(accept string) bool {
+	var jsonQ, htmlQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, exists := params["q"]; exists {
+			if parsed, err := strconv.ParseFloat(qStr, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = q
+		case "text/html":
+			htmlQ = q
+		}
+	}
+	return jsonQ > htmlQ
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
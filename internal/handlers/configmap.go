@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/controller"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CreateConfigMapHandlers builds the handler funcs for config maps
+func CreateConfigMapHandlers(lbc *controller.LoadBalancerController) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			configMap := obj.(*api_v1.ConfigMap)
+			if !lbc.IsNginxConfigMap(configMap) && !lbc.IsStreamConfigMap(configMap) {
+				lbc.EnqueueIngressForConfigMap(configMap)
+				return
+			}
+			log.Printf("Adding ConfigMap: %v", configMap.Name)
+			lbc.AddSyncQueue(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			configMap, isConfigMap := obj.(*api_v1.ConfigMap)
+			if !isConfigMap {
+				deletedState, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					log.Printf("Error received unexpected object: %v", obj)
+					return
+				}
+				configMap, ok = deletedState.Obj.(*api_v1.ConfigMap)
+				if !ok {
+					log.Printf("Error DeletedFinalStateUnknown contained non-ConfigMap object: %v", deletedState.Obj)
+					return
+				}
+			}
+			if !lbc.IsNginxConfigMap(configMap) && !lbc.IsStreamConfigMap(configMap) {
+				lbc.EnqueueIngressForConfigMap(configMap)
+				return
+			}
+			log.Printf("Removing ConfigMap: %v", configMap.Name)
+			lbc.AddSyncQueue(obj)
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			configMap := cur.(*api_v1.ConfigMap)
+			if reflect.DeepEqual(old, cur) {
+				return
+			}
+			if !lbc.IsNginxConfigMap(configMap) && !lbc.IsStreamConfigMap(configMap) {
+				lbc.EnqueueIngressForConfigMap(configMap)
+				return
+			}
+			log.Printf("ConfigMap %v changed, syncing", configMap.Name)
+			lbc.AddSyncQueue(cur)
+		},
+	}
+}
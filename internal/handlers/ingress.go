@@ -4,7 +4,6 @@ import (
 	"log"
 	"reflect"
 
-	api_v1 "k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
 
 	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/controller"
@@ -21,6 +20,10 @@ func CreateIngressHandlers(lbc *controller.LoadBalancerController) cache.Resourc
 				log.Printf("Ignoring Ingress %v based on Annotation %v\n", ingress.Name, lbc.GetIngressClassKey())
 				return
 			}
+			if !lbc.IsWatchedNamespace(ingress.Namespace) {
+				glog.V(3).Infof("Ignoring Ingress %v/%v of a namespace that isn't watched", ingress.Namespace, ingress.Name)
+				return
+			}
 			log.Printf("Adding Ingress: %v", ingress.Name)
 			lbc.AddSyncQueue(obj)
 		},
@@ -38,15 +41,19 @@ func CreateIngressHandlers(lbc *controller.LoadBalancerController) cache.Resourc
 					return
 				}
 			}
-			if !lbc.IsNginxIngress(ingress) {
+			if !lbc.IsNginxIngress(ingress) || !lbc.IsWatchedNamespace(ingress.Namespace) {
 				return
 			}
 			log.Printf("Removing Ingress: %v", ingress.Name)
 			lbc.AddSyncQueue(obj)
 		},
 		UpdateFunc: func(old, cur interface{}) {
+			ingress := cur.(*extensions.Ingress)
+			if !lbc.IsWatchedNamespace(ingress.Namespace) {
+				return
+			}
 			if !reflect.DeepEqual(old, cur) {
-				glog.V(3).Infof("Endpoints %v changed, syncing", cur.(*api_v1.Endpoints).Name)
+				glog.V(3).Infof("Ingress %v changed, syncing", ingress.Name)
 				lbc.AddSyncQueue(cur)
 			}
 		},
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/controller"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CreateNamespaceHandlers builds the handler funcs for namespaces
+func CreateNamespaceHandlers(lbc *controller.LoadBalancerController) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			lbc.UpdateNamespace(obj.(*api_v1.Namespace))
+		},
+		DeleteFunc: func(obj interface{}) {
+			ns, isNamespace := obj.(*api_v1.Namespace)
+			if !isNamespace {
+				deletedState, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					log.Printf("Error received unexpected object: %v", obj)
+					return
+				}
+				ns, ok = deletedState.Obj.(*api_v1.Namespace)
+				if !ok {
+					log.Printf("Error DeletedFinalStateUnknown contained non-Namespace object: %v", deletedState.Obj)
+					return
+				}
+			}
+			lbc.DeleteNamespace(ns)
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			lbc.UpdateNamespace(cur.(*api_v1.Namespace))
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/controller"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CreateSecretHandlers builds the handler funcs for secrets
+func CreateSecretHandlers(lbc *controller.LoadBalancerController) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			lbc.EnqueueIngressForSecret(obj.(*api_v1.Secret))
+		},
+		DeleteFunc: func(obj interface{}) {
+			secret, isSecret := obj.(*api_v1.Secret)
+			if !isSecret {
+				deletedState, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					log.Printf("Error received unexpected object: %v", obj)
+					return
+				}
+				secret, ok = deletedState.Obj.(*api_v1.Secret)
+				if !ok {
+					log.Printf("Error DeletedFinalStateUnknown contained non-Secret object: %v", deletedState.Obj)
+					return
+				}
+			}
+			lbc.EnqueueIngressForSecret(secret)
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			if !reflect.DeepEqual(old, cur) {
+				lbc.EnqueueIngressForSecret(cur.(*api_v1.Secret))
+			}
+		},
+	}
+}
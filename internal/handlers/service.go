@@ -41,7 +41,7 @@ func CreateServiceHandlers(lbc *controller.LoadBalancerController) cache.Resourc
 			if !reflect.DeepEqual(old, cur) {
 				curSvc := cur.(*api_v1.Service)
 				oldSvc := old.(*api_v1.Service)
-				if hasServicePortChanges(oldSvc.Spec.Ports, curSvc.Spec.Ports) {
+				if hasServicePortChanges(oldSvc.Spec.Ports, curSvc.Spec.Ports) || hasServiceAddressChanges(oldSvc, curSvc) {
 					fmt.Printf("Service %v changed, syncing", curSvc.Name)
 					lbc.EnqueueIngressForService(curSvc)
 				}
@@ -84,3 +84,10 @@ func hasServicePortChanges(oldServicePorts []api_v1.ServicePort, curServicePorts
 	}
 	return false
 }
+
+// hasServiceAddressChanges compares the type, the ClusterIP and the external name of the services
+func hasServiceAddressChanges(oldSvc *api_v1.Service, curSvc *api_v1.Service) bool {
+	return oldSvc.Spec.Type != curSvc.Spec.Type ||
+		oldSvc.Spec.ClusterIP != curSvc.Spec.ClusterIP ||
+		oldSvc.Spec.ExternalName != curSvc.Spec.ExternalName
+}
@@ -0,0 +1,341 @@
+// Package healthcheck implements active health checks of the endpoints of the
+// Ingress backends, driven by the readiness probes of the backend pods.
+package healthcheck
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/metrics"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Config holds the settings of the health checks.
+// Zero values are taken from the readiness probe of the backend.
+type Config struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	Fails    int32
+	Passes   int32
+}
+
+// Backend holds the endpoints of a backend and the probe to check them with
+type Backend struct {
+	Endpoints []string
+	Probe     *api_v1.Probe
+}
+
+// target is an endpoint probed on its own schedule
+type target struct {
+	url      string
+	headers  []api_v1.HTTPHeader
+	interval time.Duration
+	timeout  time.Duration
+	fails    int32
+	passes   int32
+
+	healthy   bool
+	successes int32
+	failures  int32
+	owners    map[string]bool
+	stop      chan struct{}
+}
+
+// Checker probes the endpoints of the backends and tracks their health.
+// Endpoints are considered healthy until they fail the configured number of probes in a row.
+type Checker struct {
+	config    Config
+	transport *http.Transport
+	onChange  func(owners []string)
+
+	mu      sync.Mutex
+	targets map[string]*target
+	owners  map[string]map[string]bool
+}
+
+// NewChecker creates a Checker. onChange is called with the owners of an endpoint
+// every time the endpoint becomes healthy or unhealthy.
+func NewChecker(cfg Config, onChange func(owners []string)) *Checker {
+	return &Checker{
+		config: cfg,
+		transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		onChange: onChange,
+		targets:  make(map[string]*target),
+		owners:   make(map[string]map[string]bool),
+	}
+}
+
+// Run waits for stopCh to be closed and stops probing all endpoints
+func (c *Checker) Run(stopCh <-chan struct{}) {
+	<-stopCh
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, t := range c.targets {
+		close(t.stop)
+		delete(c.targets, key)
+	}
+}
+
+// Update replaces the endpoints probed on behalf of the owner, usually an Ingress resource.
+// Endpoints no longer referenced by any owner stop being probed.
+func (c *Checker) Update(owner string, backends []Backend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make(map[string]bool)
+	for _, backend := range backends {
+		if backend.Probe == nil || backend.Probe.HTTPGet == nil {
+			continue
+		}
+		for _, endp := range backend.Endpoints {
+			key, err := targetKey(endp, backend.Probe)
+			if err != nil {
+				log.Printf("Error creating health check for endpoint %v: %v", endp, err)
+				continue
+			}
+			keys[key] = true
+
+			t, exists := c.targets[key]
+			if !exists {
+				t = c.newTarget(key, backend.Probe)
+				c.targets[key] = t
+				go c.probeLoop(t)
+			}
+			t.owners[owner] = true
+		}
+	}
+
+	for key := range c.owners[owner] {
+		if !keys[key] {
+			c.release(owner, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		delete(c.owners, owner)
+	} else {
+		c.owners[owner] = keys
+	}
+}
+
+// Remove stops probing the endpoints on behalf of the owner
+func (c *Checker) Remove(owner string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.owners[owner] {
+		c.release(owner, key)
+	}
+	delete(c.owners, owner)
+}
+
+// IsHealthy reports whether the endpoint passes the health checks of the probe.
+// Endpoints that aren't probed are considered healthy.
+func (c *Checker) IsHealthy(endpoint string, probe *api_v1.Probe) bool {
+	if probe == nil || probe.HTTPGet == nil {
+		return true
+	}
+	key, err := targetKey(endpoint, probe)
+	if err != nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, exists := c.targets[key]; exists {
+		return t.healthy
+	}
+	return true
+}
+
+func (c *Checker) release(owner string, key string) {
+	t, exists := c.targets[key]
+	if !exists {
+		return
+	}
+	delete(t.owners, owner)
+	if len(t.owners) == 0 {
+		if !t.healthy {
+			metrics.UnhealthyEndpoints.Add(-1)
+		}
+		close(t.stop)
+		delete(c.targets, key)
+	}
+}
+
+func (c *Checker) newTarget(url string, probe *api_v1.Probe) *target {
+	t := &target{
+		url:      url,
+		headers:  probe.HTTPGet.HTTPHeaders,
+		interval: time.Duration(probe.PeriodSeconds) * time.Second,
+		timeout:  time.Duration(probe.TimeoutSeconds) * time.Second,
+		fails:    probe.FailureThreshold,
+		passes:   probe.SuccessThreshold,
+		healthy:  true,
+		owners:   make(map[string]bool),
+		stop:     make(chan struct{}),
+	}
+
+	if c.config.Interval > 0 {
+		t.interval = c.config.Interval
+	}
+	if c.config.Timeout > 0 {
+		t.timeout = c.config.Timeout
+	}
+	if c.config.Fails > 0 {
+		t.fails = c.config.Fails
+	}
+	if c.config.Passes > 0 {
+		t.passes = c.config.Passes
+	}
+
+	// the defaults of the Kubernetes probes
+	if t.interval <= 0 {
+		t.interval = 10 * time.Second
+	}
+	if t.timeout <= 0 {
+		t.timeout = time.Second
+	}
+	if t.fails <= 0 {
+		t.fails = 3
+	}
+	if t.passes <= 0 {
+		t.passes = 1
+	}
+
+	return t
+}
+
+func (c *Checker) probeLoop(t *target) {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-time.After(t.interval):
+		}
+
+		ok := c.probe(t)
+		if ok {
+			metrics.HealthCheckProbes.Add("passed", 1)
+		} else {
+			metrics.HealthCheckProbes.Add("failed", 1)
+		}
+
+		if owners := c.record(t, ok); owners != nil {
+			c.onChange(owners)
+		}
+	}
+}
+
+// record updates the state of the target with the probe result.
+// It returns the owners of the target if its health has changed.
+func (c *Checker) record(t *target, ok bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-t.stop:
+		return nil
+	default:
+	}
+
+	if ok {
+		t.failures = 0
+		t.successes++
+	} else {
+		t.successes = 0
+		t.failures++
+	}
+
+	switch {
+	case t.healthy && t.failures >= t.fails:
+		t.healthy = false
+		metrics.UnhealthyEndpoints.Add(1)
+		metrics.HealthCheckTransitions.Add("unhealthy", 1)
+		log.Printf("Endpoint %v failed %v health checks in a row, marking it unhealthy", t.url, t.failures)
+	case !t.healthy && t.successes >= t.passes:
+		t.healthy = true
+		metrics.UnhealthyEndpoints.Add(-1)
+		metrics.HealthCheckTransitions.Add("healthy", 1)
+		log.Printf("Endpoint %v passed %v health checks in a row, marking it healthy", t.url, t.successes)
+	default:
+		return nil
+	}
+
+	var owners []string
+	for owner := range t.owners {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// probe sends the request of the probe to the endpoint. Unlike the kubelet, which connects to the host
+// of the probe when it's set, the endpoint is always probed, and the Host header is only taken from the headers.
+func (c *Checker) probe(t *target) bool {
+	req, err := http.NewRequest("GET", t.url, nil)
+	if err != nil {
+		return false
+	}
+	for _, header := range t.headers {
+		if strings.EqualFold(header.Name, "Host") {
+			req.Host = header.Value
+			continue
+		}
+		req.Header.Add(header.Name, header.Value)
+	}
+
+	client := &http.Client{
+		Transport: c.transport,
+		Timeout:   t.timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest
+}
+
+// targetKey returns the URL the endpoint is probed at. It's also used to identify the target.
+func targetKey(endpoint string, probe *api_v1.Probe) (string, error) {
+	ip, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	httpGet := probe.HTTPGet
+	if httpGet.Port.Type == intstr.Int && httpGet.Port.IntValue() > 0 {
+		port = httpGet.Port.String()
+	}
+
+	scheme := "http"
+	if httpGet.Scheme == api_v1.URISchemeHTTPS {
+		scheme = "https"
+	}
+
+	path := httpGet.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(ip, port), path), nil
+}
@@ -0,0 +1,55 @@
+// Package metrics holds the counters of the Ingress controller.
+// They are published with expvar and served on /debug/vars.
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+var (
+	// HealthCheckProbes counts the health check probes sent to the endpoints, by result
+	HealthCheckProbes = expvar.NewMap("health_check_probes")
+
+	// HealthCheckTransitions counts the endpoint health transitions, by the new state
+	HealthCheckTransitions = expvar.NewMap("health_check_transitions")
+
+	// UnhealthyEndpoints is the number of endpoints currently considered unhealthy
+	UnhealthyEndpoints = expvar.NewInt("unhealthy_endpoints")
+
+	// Reloads counts the reloads of NGINX, by result
+	Reloads = expvar.NewMap("nginx_reloads")
+
+	// ReloadedChanges counts the changes of the configuration applied by the reloads of NGINX
+	ReloadedChanges = expvar.NewInt("nginx_reloaded_changes")
+
+	// ReloadBatchSize is the number of changes applied by the last reload of NGINX
+	ReloadBatchSize = expvar.NewInt("nginx_reload_batch_size")
+
+	// RejectedIngresses is the number of Ingresses whose last configuration NGINX rejected
+	RejectedIngresses = expvar.NewInt("nginx_rejected_ingresses")
+
+	// Ready is set to 1 once the initial configuration of NGINX is applied
+	Ready = expvar.NewInt("ready")
+)
+
+// ListenAndServe serves the metrics on the given port,
+// and the readiness of the controller on /ready.
+func ListenAndServe(port int) {
+	http.HandleFunc("/ready", serveReady)
+	log.Printf("Serving metrics on :%v/debug/vars", port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%v", port), nil); err != nil {
+		log.Printf("Error serving metrics: %v", err)
+	}
+}
+
+// serveReady responds with 200 once the initial configuration is applied, and 503 before
+func serveReady(w http.ResponseWriter, r *http.Request) {
+	if Ready.Value() != 1 {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
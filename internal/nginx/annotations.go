@@ -0,0 +1,163 @@
+package nginx
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	lbMethodAnnotation                 = "nginx.org/lb-method"
+	keepaliveAnnotation                = "nginx.org/keepalive"
+	maxFailsAnnotation                 = "nginx.org/max-fails"
+	failTimeoutAnnotation              = "nginx.org/fail-timeout"
+	proxyNextUpstreamAnnotation        = "nginx.org/proxy-next-upstream"
+	proxyNextUpstreamTriesAnnotation   = "nginx.org/proxy-next-upstream-tries"
+	proxyNextUpstreamTimeoutAnnotation = "nginx.org/proxy-next-upstream-timeout"
+	proxyConnectTimeoutAnnotation      = "nginx.org/proxy-connect-timeout"
+	proxyReadTimeoutAnnotation         = "nginx.org/proxy-read-timeout"
+	proxySendTimeoutAnnotation         = "nginx.org/proxy-send-timeout"
+	grpcServicesAnnotation             = "nginx.org/grpc-services"
+	sslServicesAnnotation              = "nginx.org/ssl-services"
+	websocketServicesAnnotation        = "nginx.org/websocket-services"
+	websocketReadTimeoutAnnotation     = "nginx.org/websocket-read-timeout"
+	upstreamVhostAnnotation            = "nginx.org/upstream-vhost"
+)
+
+// parseAnnotations overrides the global config with the annotations of the Ingress resource.
+// Invalid annotations are logged and ignored.
+func parseAnnotations(ingEx *IngressEx, baseCfg *Config) Config {
+	cfg := *baseCfg
+	annotations := ingEx.Ingress.Annotations
+
+	if lbMethod, exists := annotations[lbMethodAnnotation]; exists {
+		if parsedMethod, err := ParseLBMethod(lbMethod); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: got %q: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, lbMethodAnnotation, lbMethod, err)
+		} else {
+			cfg.LBMethod = parsedMethod
+		}
+	}
+
+	if keepalive, exists, err := GetMapKeyAsInt64(annotations, keepaliveAnnotation); exists {
+		if err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, keepaliveAnnotation, err)
+		} else {
+			cfg.Keepalive = keepalive
+		}
+	}
+
+	if maxFails, exists, err := GetMapKeyAsInt64(annotations, maxFailsAnnotation); exists {
+		if err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, maxFailsAnnotation, err)
+		} else {
+			cfg.MaxFails = maxFails
+		}
+	}
+
+	if failTimeout, exists := annotations[failTimeoutAnnotation]; exists {
+		if parsedTime, err := ParseTime(failTimeout); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, failTimeoutAnnotation, err)
+		} else {
+			cfg.FailTimeout = parsedTime
+		}
+	}
+
+	if nextUpstream, exists := annotations[proxyNextUpstreamAnnotation]; exists {
+		if parsedNextUpstream, err := ParseProxyNextUpstream(nextUpstream); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyNextUpstreamAnnotation, err)
+		} else {
+			cfg.ProxyNextUpstream = parsedNextUpstream
+		}
+	}
+
+	if tries, exists, err := GetMapKeyAsInt64(annotations, proxyNextUpstreamTriesAnnotation); exists {
+		if err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyNextUpstreamTriesAnnotation, err)
+		} else {
+			cfg.ProxyNextUpstreamTries = tries
+		}
+	}
+
+	if nextUpstreamTimeout, exists := annotations[proxyNextUpstreamTimeoutAnnotation]; exists {
+		if parsedTime, err := ParseTime(nextUpstreamTimeout); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyNextUpstreamTimeoutAnnotation, err)
+		} else {
+			cfg.ProxyNextUpstreamTimeout = parsedTime
+		}
+	}
+
+	if connectTimeout, exists := annotations[proxyConnectTimeoutAnnotation]; exists {
+		if parsedTime, err := ParseTime(connectTimeout); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyConnectTimeoutAnnotation, err)
+		} else {
+			cfg.ProxyConnectTimeout = parsedTime
+		}
+	}
+
+	if readTimeout, exists := annotations[proxyReadTimeoutAnnotation]; exists {
+		if parsedTime, err := ParseTime(readTimeout); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyReadTimeoutAnnotation, err)
+		} else {
+			cfg.ProxyReadTimeout = parsedTime
+		}
+	}
+
+	if sendTimeout, exists := annotations[proxySendTimeoutAnnotation]; exists {
+		if parsedTime, err := ParseTime(sendTimeout); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxySendTimeoutAnnotation, err)
+		} else {
+			cfg.ProxySendTimeout = parsedTime
+		}
+	}
+
+	if wsTimeout, exists := annotations[websocketReadTimeoutAnnotation]; exists {
+		if parsedTime, err := ParseTime(wsTimeout); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, websocketReadTimeoutAnnotation, err)
+		} else {
+			cfg.WebSocketReadTimeout = parsedTime
+		}
+	}
+
+	return cfg
+}
+
+// getServicesFromAnnotation returns the set of the comma separated service names of the annotation
+func getServicesFromAnnotation(ingEx *IngressEx, annotation string) map[string]bool {
+	services := make(map[string]bool)
+
+	if value, exists := ingEx.Ingress.Annotations[annotation]; exists {
+		for _, svc := range strings.Split(value, ",") {
+			if svc = strings.TrimSpace(svc); svc != "" {
+				services[svc] = true
+			}
+		}
+	}
+
+	return services
+}
+
+// getUpstreamVhost returns the Host header of the requests to the backends of the Ingress,
+// or $host to keep the one of the client
+func getUpstreamVhost(ingEx *IngressEx) string {
+	vhost, exists := ingEx.Ingress.Annotations[upstreamVhostAnnotation]
+	if !exists {
+		return "$host"
+	}
+
+	host := vhost
+	if h, port, err := net.SplitHostPort(vhost); err == nil {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %q has an invalid port, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, upstreamVhostAnnotation, vhost)
+			return "$host"
+		}
+		host = h
+	}
+	if err := validateHost(host); err != nil || isWildcardHost(host) {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %q must be a host with an optional port, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, upstreamVhostAnnotation, vhost)
+		return "$host"
+	}
+
+	return vhost
+}
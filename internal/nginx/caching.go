@@ -0,0 +1,264 @@
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	proxyCacheAnnotation       = "nginx.org/proxy-cache"
+	proxyCacheKeyAnnotation    = "nginx.org/proxy-cache-key"
+	proxyCacheValidAnnotation  = "nginx.org/proxy-cache-valid"
+	proxyCacheBypassAnnotation = "nginx.org/proxy-cache-bypass"
+)
+
+const defaultProxyCacheKey = "$scheme$proxy_host$request_uri"
+
+// CacheZone describes a cache zone defined with proxy_cache_path
+type CacheZone struct {
+	Name     string
+	Path     string
+	Size     string
+	Inactive string
+	MaxSize  string
+}
+
+// ProxyCache describes the caching of the responses of a location
+type ProxyCache struct {
+	Zone   string
+	Key    string
+	Valid  []string
+	Bypass string
+}
+
+var (
+	cacheZoneNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	sizeRegexp          = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+	statusCodeRegexp    = regexp.MustCompile(`^([1-5][0-9][0-9]|any)$`)
+	headerNameRegexp    = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// parseCacheZones parses the cache zones of the proxy-cache-zones key, one zone per line:
+// <name> path=<path> size=<size> [inactive=<time>] [max_size=<size>]
+func parseCacheZones(value string) ([]CacheZone, error) {
+	var zones []CacheZone
+	names := make(map[string]bool)
+
+	for _, line := range strings.Split(value, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		zone := CacheZone{Name: fields[0]}
+		if !cacheZoneNameRegexp.MatchString(zone.Name) {
+			return nil, fmt.Errorf("invalid zone name %q", zone.Name)
+		}
+		if names[zone.Name] {
+			return nil, fmt.Errorf("zone %q is defined more than once", zone.Name)
+		}
+		names[zone.Name] = true
+
+		for _, field := range fields[1:] {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("zone %q: invalid parameter %q", zone.Name, field)
+			}
+
+			var err error
+			switch parts[0] {
+			case "path":
+				zone.Path, err = parseCachePath(parts[1])
+			case "size":
+				zone.Size, err = parseSize(parts[1])
+			case "inactive":
+				zone.Inactive, err = ParseTime(parts[1])
+			case "max_size":
+				zone.MaxSize, err = parseSize(parts[1])
+			default:
+				err = fmt.Errorf("unknown parameter %q", parts[0])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("zone %q: %v", zone.Name, err)
+			}
+		}
+
+		if zone.Path == "" || zone.Size == "" {
+			return nil, fmt.Errorf("zone %q: path and size are required", zone.Name)
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+func parseCachePath(p string) (string, error) {
+	if !path.IsAbs(p) || strings.ContainsAny(p, "\"';{}\\$") {
+		return "", fmt.Errorf("invalid path %q: must be absolute and must not contain any of \"';{}\\$", p)
+	}
+	return path.Clean(p), nil
+}
+
+func parseSize(size string) (string, error) {
+	if !sizeRegexp.MatchString(size) {
+		return "", fmt.Errorf("invalid size %q: must be a number with an optional k, m or g suffix", size)
+	}
+	return size, nil
+}
+
+// CreateCacheDirs creates the directories of the cache zones and ensures they are writable.
+// It returns the zones whose directories are usable, the others are logged and dropped.
+func (nginx *Controller) CreateCacheDirs(zones []CacheZone) []CacheZone {
+	if nginx.local {
+		return zones
+	}
+
+	var valid []CacheZone
+	for _, zone := range zones {
+		if err := createCacheDir(zone.Path); err != nil {
+			glog.Errorf("Cache zone %v: %v, ignoring", zone.Name, err)
+			continue
+		}
+		valid = append(valid, zone)
+	}
+	return valid
+}
+
+func createCacheDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+
+	f, err := ioutil.TempFile(dir, ".write-check")
+	if err != nil {
+		return fmt.Errorf("%v is not writable: %v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// getProxyCache returns the caching of the locations of the Ingress, or nil if it's disabled.
+// The zone must be one of the zones of the ConfigMap.
+func getProxyCache(ingEx *IngressEx, cfg *Config) *ProxyCache {
+	annotations := ingEx.Ingress.Annotations
+
+	zone, exists := annotations[proxyCacheAnnotation]
+	if !exists || zone == "off" {
+		return nil
+	}
+
+	defined := false
+	for _, z := range cfg.ProxyCacheZones {
+		if z.Name == zone {
+			defined = true
+			break
+		}
+	}
+	if !defined {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: cache zone %q isn't defined in the ConfigMap, ignoring",
+			ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyCacheAnnotation, zone)
+		return nil
+	}
+
+	cache := &ProxyCache{
+		Zone: zone,
+		Key:  defaultProxyCacheKey,
+	}
+
+	if key, exists := annotations[proxyCacheKeyAnnotation]; exists {
+		if key == "" || strings.ContainsAny(key, "\"';{}\\") || strings.IndexFunc(key, isSpace) >= 0 {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %q must not be empty or contain whitespace or any of \"';{}\\",
+				ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyCacheKeyAnnotation, key)
+		} else {
+			cache.Key = key
+		}
+	}
+
+	if valid, exists := annotations[proxyCacheValidAnnotation]; exists {
+		if rules, err := parseProxyCacheValid(valid); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyCacheValidAnnotation, err)
+		} else {
+			cache.Valid = rules
+		}
+	}
+
+	if bypass, exists := annotations[proxyCacheBypassAnnotation]; exists {
+		if variables, err := parseProxyCacheBypass(bypass); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, proxyCacheBypassAnnotation, err)
+		} else {
+			cache.Bypass = variables
+		}
+	}
+
+	return cache
+}
+
+// parseProxyCacheValid parses semicolon separated rules of the form [<code> ...] <time>,
+// e.g. `200 302 10m; 404 1m`
+func parseProxyCacheValid(value string) ([]string, error) {
+	var rules []string
+
+	for _, rule := range strings.Split(value, ";") {
+		fields := strings.Fields(rule)
+		if len(fields) == 0 {
+			continue
+		}
+
+		for _, code := range fields[:len(fields)-1] {
+			if !statusCodeRegexp.MatchString(code) {
+				return nil, fmt.Errorf("invalid status code %q in rule %q", code, strings.TrimSpace(rule))
+			}
+		}
+		if _, err := ParseTime(fields[len(fields)-1]); err != nil {
+			return nil, fmt.Errorf("invalid time in rule %q: %v", strings.TrimSpace(rule), err)
+		}
+
+		rules = append(rules, strings.Join(fields, " "))
+	}
+
+	return rules, nil
+}
+
+// parseProxyCacheBypass parses comma separated cookies and headers of the form cookie:<name> or header:<name>
+// into the NGINX variables that bypass the cache when they are not empty
+func parseProxyCacheBypass(value string) (string, error) {
+	var variables []string
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || !headerNameRegexp.MatchString(parts[1]) {
+			return "", fmt.Errorf("%q must be cookie:<name> or header:<name>", item)
+		}
+
+		switch parts[0] {
+		case "cookie":
+			variables = append(variables, "$cookie_"+parts[1])
+		case "header":
+			variables = append(variables, "$http_"+strings.Replace(strings.ToLower(parts[1]), "-", "_", -1))
+		default:
+			return "", fmt.Errorf("%q must be cookie:<name> or header:<name>", item)
+		}
+	}
+
+	return strings.Join(variables, " "), nil
+}
@@ -0,0 +1,76 @@
+package nginx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCacheZones(t *testing.T) {
+	tests := []struct {
+		msg      string
+		value    string
+		expected []CacheZone
+	}{
+		{
+			msg:      "no zones",
+			value:    "",
+			expected: nil,
+		},
+		{
+			msg:   "one zone with the required parameters",
+			value: "static path=/var/cache/nginx/static size=10m",
+			expected: []CacheZone{
+				{Name: "static", Path: "/var/cache/nginx/static", Size: "10m"},
+			},
+		},
+		{
+			msg: "zones with all the parameters, blank lines and cleaned paths",
+			value: `
+static path=/var/cache/nginx/static size=10m inactive=60m max_size=1g
+
+  api   path=/var/cache/nginx/../api/ size=5M
+`,
+			expected: []CacheZone{
+				{Name: "static", Path: "/var/cache/nginx/static", Size: "10m", Inactive: "60m", MaxSize: "1g"},
+				{Name: "api", Path: "/var/cache/api", Size: "5M"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		zones, err := parseCacheZones(test.value)
+		if err != nil {
+			t.Errorf("parseCacheZones() returned an error for the case of %s: %v", test.msg, err)
+			continue
+		}
+		if !reflect.DeepEqual(zones, test.expected) {
+			t.Errorf("parseCacheZones() returned %+v for the case of %s, expected %+v", zones, test.msg, test.expected)
+		}
+	}
+}
+
+func TestParseCacheZonesFails(t *testing.T) {
+	tests := []struct {
+		msg   string
+		value string
+	}{
+		{"invalid name", "static-files path=/var/cache/nginx/static size=10m"},
+		{"duplicate name", "static path=/var/cache/a size=10m\nstatic path=/var/cache/b size=10m"},
+		{"missing path", "static size=10m"},
+		{"missing size", "static path=/var/cache/nginx/static"},
+		{"relative path", "static path=cache/static size=10m"},
+		{"path with a variable", "static path=/var/cache/$host size=10m"},
+		{"path with a semicolon", "static path=/var/cache;static size=10m"},
+		{"invalid size", "static path=/var/cache/nginx/static size=10mb"},
+		{"invalid max size", "static path=/var/cache/nginx/static size=10m max_size=large"},
+		{"invalid inactive time", "static path=/var/cache/nginx/static size=10m inactive=1hour"},
+		{"unknown parameter", "static path=/var/cache/nginx/static size=10m levels=1:2"},
+		{"parameter without a value", "static path=/var/cache/nginx/static size=10m inactive"},
+	}
+
+	for _, test := range tests {
+		if zones, err := parseCacheZones(test.value); err == nil {
+			t.Errorf("parseCacheZones() returned %+v instead of an error for the case of %s", zones, test.msg)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package nginx
+
+// Config holds NGINX configuration parameters
+type Config struct {
+	LBMethod                 string
+	Keepalive                int64
+	MaxFails                 int64
+	FailTimeout              string
+	ProxyNextUpstream        string
+	ProxyNextUpstreamTries   int64
+	ProxyNextUpstreamTimeout string
+	ProxyConnectTimeout      string
+	ProxyReadTimeout         string
+	ProxySendTimeout         string
+	WebSocketReadTimeout     string
+	ProxyCacheZones          []CacheZone
+	Gzip                     bool
+	GzipLevel                int64
+	GzipMinLength            int64
+	GzipTypes                string
+	GzipProxied              string
+	GzipStatic               bool
+	CatchAllHost             string
+	HTTPPort                 int64
+	HTTPSPort                int64
+	Resolver                 string
+	ResolverValid            string
+
+	DefaultBackendHTMLTemplate string
+	DefaultBackendJSONTemplate string
+}
+
+// NewDefaultConfig creates a Config with default values
+func NewDefaultConfig() *Config {
+	return &Config{
+		LBMethod:                 "",
+		Keepalive:                0,
+		MaxFails:                 1,
+		FailTimeout:              "10s",
+		ProxyNextUpstream:        "error timeout",
+		ProxyNextUpstreamTries:   0,
+		ProxyNextUpstreamTimeout: "0s",
+		ProxyConnectTimeout:      "60s",
+		ProxyReadTimeout:         "60s",
+		ProxySendTimeout:         "60s",
+		WebSocketReadTimeout:     "3600s",
+		Gzip:                     false,
+		GzipLevel:                1,
+		GzipMinLength:            20,
+		GzipProxied:              "any",
+		GzipStatic:               false,
+		HTTPPort:                 80,
+		HTTPSPort:                443,
+		Resolver:                 getDefaultResolver(),
+	}
+}
@@ -0,0 +1,217 @@
+package nginx
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	api_v1 "k8s.io/api/core/v1"
+)
+
+// ParseConfigMap parses the ConfigMap with the NGINX configuration into a Config.
+// Invalid values are logged and replaced with the defaults.
+func ParseConfigMap(cfgm *api_v1.ConfigMap) *Config {
+	cfg := NewDefaultConfig()
+
+	if lbMethod, exists := cfgm.Data["lb-method"]; exists {
+		if parsedMethod, err := ParseLBMethod(lbMethod); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the lb-method key: got %q: %v", cfgm.GetNamespace(), cfgm.GetName(), lbMethod, err)
+		} else {
+			cfg.LBMethod = parsedMethod
+		}
+	}
+
+	if keepalive, exists, err := GetMapKeyAsInt64(cfgm.Data, "keepalive"); exists {
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the keepalive key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.Keepalive = keepalive
+		}
+	}
+
+	if maxFails, exists, err := GetMapKeyAsInt64(cfgm.Data, "max-fails"); exists {
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the max-fails key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.MaxFails = maxFails
+		}
+	}
+
+	if failTimeout, exists := cfgm.Data["fail-timeout"]; exists {
+		if parsedTime, err := ParseTime(failTimeout); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the fail-timeout key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.FailTimeout = parsedTime
+		}
+	}
+
+	if nextUpstream, exists := cfgm.Data["proxy-next-upstream"]; exists {
+		if parsedNextUpstream, err := ParseProxyNextUpstream(nextUpstream); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the proxy-next-upstream key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ProxyNextUpstream = parsedNextUpstream
+		}
+	}
+
+	if tries, exists, err := GetMapKeyAsInt64(cfgm.Data, "proxy-next-upstream-tries"); exists {
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the proxy-next-upstream-tries key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ProxyNextUpstreamTries = tries
+		}
+	}
+
+	if nextUpstreamTimeout, exists := cfgm.Data["proxy-next-upstream-timeout"]; exists {
+		if parsedTime, err := ParseTime(nextUpstreamTimeout); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the proxy-next-upstream-timeout key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ProxyNextUpstreamTimeout = parsedTime
+		}
+	}
+
+	if connectTimeout, exists := cfgm.Data["proxy-connect-timeout"]; exists {
+		if parsedTime, err := ParseTime(connectTimeout); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the proxy-connect-timeout key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ProxyConnectTimeout = parsedTime
+		}
+	}
+
+	if readTimeout, exists := cfgm.Data["proxy-read-timeout"]; exists {
+		if parsedTime, err := ParseTime(readTimeout); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the proxy-read-timeout key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ProxyReadTimeout = parsedTime
+		}
+	}
+
+	if sendTimeout, exists := cfgm.Data["proxy-send-timeout"]; exists {
+		if parsedTime, err := ParseTime(sendTimeout); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the proxy-send-timeout key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ProxySendTimeout = parsedTime
+		}
+	}
+
+	if wsTimeout, exists := cfgm.Data["websocket-read-timeout"]; exists {
+		if parsedTime, err := ParseTime(wsTimeout); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the websocket-read-timeout key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.WebSocketReadTimeout = parsedTime
+		}
+	}
+
+	if cacheZones, exists := cfgm.Data["proxy-cache-zones"]; exists {
+		if zones, err := parseCacheZones(cacheZones); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the proxy-cache-zones key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ProxyCacheZones = zones
+		}
+	}
+
+	if gzip, exists, err := GetMapKeyAsBool(cfgm.Data, "gzip"); exists {
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the gzip key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.Gzip = gzip
+		}
+	}
+
+	if level, exists, err := GetMapKeyAsInt64(cfgm.Data, "gzip-level"); exists {
+		if err == nil && (level < 1 || level > 9) {
+			err = fmt.Errorf("gzip-level must be between 1 and 9: got %d", level)
+		}
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the gzip-level key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.GzipLevel = level
+		}
+	}
+
+	if minLength, exists, err := GetMapKeyAsInt64(cfgm.Data, "gzip-min-length"); exists {
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the gzip-min-length key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.GzipMinLength = minLength
+		}
+	}
+
+	if types, exists := cfgm.Data["gzip-types"]; exists {
+		if parsedTypes, err := ParseGzipTypes(types); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the gzip-types key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.GzipTypes = parsedTypes
+		}
+	}
+
+	if proxied, exists := cfgm.Data["gzip-proxied"]; exists {
+		if parsedProxied, err := ParseGzipProxied(proxied); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the gzip-proxied key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.GzipProxied = parsedProxied
+		}
+	}
+
+	if gzipStatic, exists, err := GetMapKeyAsBool(cfgm.Data, "gzip-static"); exists {
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the gzip-static key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.GzipStatic = gzipStatic
+		}
+	}
+
+	if port, exists, err := GetMapKeyAsInt64(cfgm.Data, "http-port"); exists {
+		if err == nil && (port < 1 || port > 65535) {
+			err = fmt.Errorf("http-port must be between 1 and 65535: got %d", port)
+		}
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the http-port key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.HTTPPort = port
+		}
+	}
+
+	if port, exists, err := GetMapKeyAsInt64(cfgm.Data, "https-port"); exists {
+		if err == nil && (port < 1 || port > 65535) {
+			err = fmt.Errorf("https-port must be between 1 and 65535: got %d", port)
+		}
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the https-port key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.HTTPSPort = port
+		}
+	}
+
+	if resolver, exists := cfgm.Data["resolver"]; exists {
+		if parsedResolver, err := ParseResolver(resolver); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the resolver key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.Resolver = parsedResolver
+		}
+	}
+
+	if valid, exists := cfgm.Data["resolver-valid"]; exists {
+		if parsedTime, err := ParseTime(valid); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the resolver-valid key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.ResolverValid = parsedTime
+		}
+	}
+
+	if host, exists := cfgm.Data["catch-all-host"]; exists {
+		if err := validateHost(host); err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid value for the catch-all-host key: %v", cfgm.GetNamespace(), cfgm.GetName(), err)
+		} else {
+			cfg.CatchAllHost = host
+		}
+	}
+
+	if htmlTemplate, exists := cfgm.Data["default-backend-html-template"]; exists {
+		cfg.DefaultBackendHTMLTemplate = htmlTemplate
+	}
+
+	if jsonTemplate, exists := cfgm.Data["default-backend-json-template"]; exists {
+		cfg.DefaultBackendJSONTemplate = jsonTemplate
+	}
+
+	return cfg
+}
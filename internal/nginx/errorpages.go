@@ -0,0 +1,30 @@
+package nginx
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+)
+
+// getErrorPages returns the custom error pages of the Ingress sorted by status code.
+// Keys that aren't error status codes are logged and ignored.
+func getErrorPages(ingEx *IngressEx) []ErrorPage {
+	var pages []ErrorPage
+
+	for key, body := range ingEx.ErrorPages {
+		code, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || code < 300 || code > 599 {
+			glog.Errorf("Ingress %s/%s: Invalid custom error page %q: must be a status code between 300 and 599, ignoring",
+				ingEx.Ingress.Namespace, ingEx.Ingress.Name, key)
+			continue
+		}
+		pages = append(pages, ErrorPage{Code: code, Body: []byte(body)})
+	}
+
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Code < pages[j].Code
+	})
+
+	return pages
+}
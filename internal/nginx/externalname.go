@@ -0,0 +1,102 @@
+package nginx
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+const resolvConfPath = "/etc/resolv.conf"
+
+var (
+	defaultResolverOnce sync.Once
+	defaultResolver     string
+)
+
+// getDefaultResolver returns the name servers of /etc/resolv.conf of the pod, read once
+func getDefaultResolver() string {
+	defaultResolverOnce.Do(func() {
+		f, err := os.Open(resolvConfPath)
+		if err != nil {
+			glog.Warningf("Failed to read the name servers of %v: %v", resolvConfPath, err)
+			return
+		}
+		defer f.Close()
+
+		var servers []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || fields[0] != "nameserver" {
+				continue
+			}
+			ip := net.ParseIP(fields[1])
+			if ip == nil {
+				continue
+			}
+			if ip.To4() == nil {
+				servers = append(servers, "["+ip.String()+"]")
+			} else {
+				servers = append(servers, ip.String())
+			}
+		}
+		defaultResolver = strings.Join(servers, " ")
+	})
+	return defaultResolver
+}
+
+// ParseResolver ensures that the string value is a list of name server addresses with optional ports,
+// separated by spaces or commas, e.g. "10.0.0.10 10.0.0.11:5353"
+func ParseResolver(s string) (string, error) {
+	addresses := strings.Fields(strings.Replace(s, ",", " ", -1))
+	if len(addresses) == 0 {
+		return "", fmt.Errorf("Invalid resolver: must not be empty")
+	}
+
+	for _, address := range addresses {
+		host := address
+		if h, port, err := net.SplitHostPort(address); err == nil {
+			if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+				return "", fmt.Errorf("Invalid resolver address %q: invalid port", address)
+			}
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if net.ParseIP(host) == nil && validateHost(host) != nil {
+			return "", fmt.Errorf("Invalid resolver address %q: must be an IP address or a host with an optional port", address)
+		}
+	}
+
+	return strings.Join(addresses, " "), nil
+}
+
+func isExternalName(ingEx *IngressEx, svcPort string) bool {
+	_, exists := ingEx.ExternalNames[svcPort]
+	return exists
+}
+
+// setLocationExternalName makes the location proxy to the external name of an ExternalName service.
+// NGINX resolves it at runtime with the resolver of the ConfigMap.
+func setLocationExternalName(loc *Location, ingEx *IngressEx, svcPort string) error {
+	externalName, exists := ingEx.ExternalNames[svcPort]
+	if !exists {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(externalName)
+	if err != nil {
+		return fmt.Errorf("Invalid external name %q: %v", externalName, err)
+	}
+	if err := validateHost(strings.ToLower(strings.TrimSuffix(host, "."))); err != nil || isWildcardHost(host) {
+		return fmt.Errorf("Invalid external name %q: must be a DNS name", host)
+	}
+
+	loc.ExternalName = strings.ToLower(externalName)
+	return nil
+}
@@ -0,0 +1,28 @@
+package nginx
+
+import (
+	"fmt"
+)
+
+// setServerGRPC enables HTTP/2 for the server if any of its locations proxies to a gRPC service.
+// gRPC requires HTTP/2, which NGINX only negotiates on TLS listeners, so the server must have TLS.
+func setServerGRPC(server *Server) error {
+	grpcLocations := 0
+	for _, loc := range server.Locations {
+		if loc.GRPC && loc.Return == nil {
+			grpcLocations++
+		}
+	}
+
+	if grpcLocations == 0 {
+		return nil
+	}
+	if !server.SSL {
+		return fmt.Errorf("gRPC services require TLS, add the host to the tls section of the Ingress")
+	}
+
+	server.GRPC = true
+	server.GRPCOnly = grpcLocations == len(server.Locations)
+	server.HTTP2 = true
+	return nil
+}
@@ -0,0 +1,49 @@
+package nginx
+
+import (
+	"github.com/golang/glog"
+)
+
+const (
+	gzipAnnotation      = "nginx.org/gzip"
+	gzipTypesAnnotation = "nginx.org/gzip-types"
+)
+
+// Gzip describes the compression settings of the servers of an Ingress
+// that override the global ones
+type Gzip struct {
+	Enabled bool
+	Types   string
+}
+
+// getGzip returns the compression settings of the Ingress, or nil if the Ingress uses the global settings
+func getGzip(ingEx *IngressEx, cfg *Config) *Gzip {
+	annotations := ingEx.Ingress.Annotations
+
+	enabled, enabledExists, err := GetMapKeyAsBool(annotations, gzipAnnotation)
+	if err != nil {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, gzipAnnotation, err)
+		enabledExists = false
+	}
+
+	var types string
+	if value, exists := annotations[gzipTypesAnnotation]; exists {
+		if parsed, err := ParseGzipTypes(value); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, gzipTypesAnnotation, err)
+		} else {
+			types = parsed
+		}
+	}
+
+	if !enabledExists && types == "" {
+		return nil
+	}
+	if !enabledExists {
+		enabled = cfg.Gzip
+	}
+
+	return &Gzip{
+		Enabled: enabled,
+		Types:   types,
+	}
+}
@@ -0,0 +1,141 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	extensions "k8s.io/api/extensions/v1beta1"
+)
+
+// defaultServerName is the name of the default server of the rules without a host.
+// It also matches the requests without a Host header.
+const defaultServerName = `""`
+
+var hostRegexp = regexp.MustCompile(`^(\*\.)?[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// validateHost ensures the host is a DNS name, optionally with a leading wildcard label like *.example.com
+func validateHost(host string) error {
+	if !hostRegexp.MatchString(host) {
+		return fmt.Errorf("Invalid host %q: must be a lowercase DNS name, optionally starting with *.", host)
+	}
+	return nil
+}
+
+// isWildcardHost reports whether the host matches all the subdomains of a domain
+func isWildcardHost(host string) bool {
+	return strings.HasPrefix(host, "*.")
+}
+
+// mergeRulesByHost returns the HTTP rules of the Ingress with the paths of the rules for the same host merged
+// into the first one, as NGINX can only have one server for a host
+func mergeRulesByHost(ingEx *IngressEx) []extensions.IngressRule {
+	var rules []extensions.IngressRule
+	hosts := make(map[string]int)
+	for _, rule := range ingEx.Ingress.Spec.Rules {
+		if rule.IngressRuleValue.HTTP == nil {
+			continue
+		}
+		i, exists := hosts[rule.Host]
+		if !exists {
+			hosts[rule.Host] = len(rules)
+			rules = append(rules, extensions.IngressRule{
+				Host: rule.Host,
+				IngressRuleValue: extensions.IngressRuleValue{
+					HTTP: &extensions.HTTPIngressRuleValue{},
+				},
+			})
+			i = len(rules) - 1
+		}
+		rules[i].HTTP.Paths = append(rules[i].HTTP.Paths, rule.HTTP.Paths...)
+	}
+	return rules
+}
+
+// hasRuleWithoutHost reports whether the Ingress has an HTTP rule without a host
+func hasRuleWithoutHost(ingEx *IngressEx) bool {
+	for _, rule := range ingEx.Ingress.Spec.Rules {
+		if rule.IngressRuleValue.HTTP != nil && rule.Host == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// getServerName returns the server name of the rule. Rules without a host go to the catch-all server
+// of the ConfigMap or, if there's none, to the default server. Only one Ingress can have either, so
+// the rules without a host of the other ones are skipped: skip is true and the server isn't generated.
+func (cnf *NgxConfig) getServerName(ingEx *IngressEx, host string) (name string, defaultServer bool, skip bool, err error) {
+	if host != "" {
+		return host, false, false, validateHost(host)
+	}
+
+	if owner := cnf.getDefaultServerIngress(); owner != objectMetaToFileName(&ingEx.Ingress.ObjectMeta) {
+		ownerEx := cnf.defaultServerIngresses[owner]
+		glog.Warningf("Ingress %v/%v: Skipping the rules without a host, the older Ingress %v/%v has rules without a host too",
+			ingEx.Ingress.Namespace, ingEx.Ingress.Name, ownerEx.Ingress.Namespace, ownerEx.Ingress.Name)
+		return "", false, true, nil
+	}
+
+	if cnf.config.CatchAllHost != "" {
+		return cnf.config.CatchAllHost, false, false, nil
+	}
+	return defaultServerName, true, false, nil
+}
+
+// getDefaultServerIngress returns the name of the Ingress whose rules without a host get the default server,
+// or the catch-all server: the oldest one, then the first by namespace and name, so the choice doesn't depend
+// on the order of the syncs.
+func (cnf *NgxConfig) getDefaultServerIngress() string {
+	owner := ""
+	for name, ingEx := range cnf.defaultServerIngresses {
+		if owner == "" || isOlderIngress(ingEx.Ingress, cnf.defaultServerIngresses[owner].Ingress) {
+			owner = name
+		}
+	}
+	return owner
+}
+
+func isOlderIngress(ing *extensions.Ingress, other *extensions.Ingress) bool {
+	if !ing.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return ing.CreationTimestamp.Before(&other.CreationTimestamp)
+	}
+	if ing.Namespace != other.Namespace {
+		return ing.Namespace < other.Namespace
+	}
+	return ing.Name < other.Name
+}
+
+// setDefaultServerIngress records whether the Ingress competes for the default server
+func (cnf *NgxConfig) setDefaultServerIngress(name string, ingEx *IngressEx) {
+	if ingEx != nil && hasRuleWithoutHost(ingEx) {
+		cnf.defaultServerIngresses[name] = ingEx
+	} else {
+		delete(cnf.defaultServerIngresses, name)
+	}
+}
+
+// updateDefaultServer regenerates the configuration of the Ingresses that gained or lost the default server
+// since it was owned by the previous Ingress, after the change of an Ingress. An Ingress whose configuration
+// can't be regenerated is removed, as its last configuration may still have the default server.
+func (cnf *NgxConfig) updateDefaultServer(previous string, changed string) error {
+	owner := cnf.getDefaultServerIngress()
+	if owner == previous {
+		return nil
+	}
+
+	for _, name := range []string{previous, owner} {
+		ingEx, exists := cnf.defaultServerIngresses[name]
+		if !exists || name == changed {
+			continue
+		}
+		if err := cnf.writeIngress(name, ingEx); err != nil {
+			glog.Warningf("Removing the configuration of Ingress %v/%v: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, err)
+			if err := cnf.removeIngress(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
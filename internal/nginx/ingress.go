@@ -8,7 +8,15 @@ import (
 // IngressEx holds an Ingress along with Secrets and Endpoints of the services
 // that are referenced in this Ingress
 type IngressEx struct {
-	Ingress      *extensions.Ingress
-	Endpoints    map[string][]string
+	Ingress   *extensions.Ingress
+	Endpoints map[string][]string
+	// HealthChecks holds the readiness probes the endpoints are health checked with, by endpoint address
 	HealthChecks map[string]*api_v1.Probe
+	ErrorPages   map[string]string
+	TLSSecrets   map[string]*api_v1.Secret
+	// BackendProtocols holds the protocols inferred from the service ports, keyed like Endpoints
+	BackendProtocols map[string]string
+	FastCGIParams    map[string]string
+	// ExternalNames holds the external names and ports of the ExternalName services, keyed like Endpoints
+	ExternalNames map[string]string
 }
@@ -0,0 +1,152 @@
+package nginx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	listenPortsAnnotation    = "nginx.org/listen-ports"
+	listenPortsSSLAnnotation = "nginx.org/listen-ports-ssl"
+	serverAliasAnnotation    = "nginx.org/server-alias"
+)
+
+// getListenPorts returns the ports of the annotation, or defaultPorts if it's not set or invalid
+func getListenPorts(ingEx *IngressEx, annotation string, defaultPorts []int) []int {
+	value, exists := ingEx.Ingress.Annotations[annotation]
+	if !exists {
+		return defaultPorts
+	}
+
+	ports, err := parsePorts(value)
+	if err != nil {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v, using %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, annotation, err, defaultPorts)
+		return defaultPorts
+	}
+	return ports
+}
+
+// parsePorts parses comma separated ports, e.g. "80,8080"
+func parsePorts(value string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("%q is not a valid port", p)
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports")
+	}
+	return ports, nil
+}
+
+// getServerAliases returns the extra server names of the nginx.org/server-alias annotation.
+// Invalid names are logged and ignored.
+func getServerAliases(ingEx *IngressEx) []string {
+	var aliases []string
+
+	if value, exists := ingEx.Ingress.Annotations[serverAliasAnnotation]; exists {
+		for _, alias := range strings.Split(value, ",") {
+			alias = strings.TrimSpace(alias)
+			if alias == "" {
+				continue
+			}
+			if err := validateHost(alias); err != nil {
+				glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, serverAliasAnnotation, err)
+				continue
+			}
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases
+}
+
+// getHTTPPorts returns the plain HTTP ports the servers of the Ingress listen on
+func getHTTPPorts(cfg *IngressNginxConfig) []int {
+	var ports []int
+	for _, server := range cfg.Servers {
+		ports = append(ports, server.Ports...)
+	}
+	return ports
+}
+
+// getSSLPorts returns the HTTPS ports the servers of the Ingress listen on
+func getSSLPorts(cfg *IngressNginxConfig) []int {
+	var ports []int
+	for _, server := range cfg.Servers {
+		ports = append(ports, server.SSLPorts...)
+	}
+	return ports
+}
+
+// updateListenPorts records the plain HTTP and the HTTPS ports of the Ingress and regenerates the main config
+// if the default server must listen on a new port or no longer on an old one, so that the requests for unknown
+// hosts on those ports are answered by it, or if a port is no longer available to the stream services or
+// available again
+func (cnf *NgxConfig) updateListenPorts(name string, ports []int, sslPorts []int) error {
+	before := fmt.Sprint(cnf.getExtraListenPorts(), cnf.getSSLListenPorts())
+	if ports == nil {
+		delete(cnf.listenPorts, name)
+	} else {
+		cnf.listenPorts[name] = ports
+	}
+	if sslPorts == nil {
+		delete(cnf.sslListenPorts, name)
+	} else {
+		cnf.sslListenPorts[name] = sslPorts
+	}
+
+	if before == fmt.Sprint(cnf.getExtraListenPorts(), cnf.getSSLListenPorts()) {
+		return nil
+	}
+	return cnf.updateMainConfig()
+}
+
+// getExtraListenPorts returns the sorted plain HTTP ports of all Ingresses other than the http-port of the ConfigMap
+func (cnf *NgxConfig) getExtraListenPorts() []int {
+	seen := map[int]bool{int(cnf.config.HTTPPort): true}
+	var ports []int
+	for _, ingPorts := range cnf.listenPorts {
+		for _, port := range ingPorts {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// getSSLListenPorts returns the sorted HTTPS ports of all Ingresses
+func (cnf *NgxConfig) getSSLListenPorts() []int {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, ingPorts := range cnf.sslListenPorts {
+		for _, port := range ingPorts {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
@@ -0,0 +1,106 @@
+package nginx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const pathRegexAnnotation = "nginx.org/path-regex"
+
+// Path types of the nginx.org/path-regex annotation
+const (
+	pathTypePrefix          = ""
+	pathTypeCaseSensitive   = "case_sensitive"
+	pathTypeCaseInsensitive = "case_insensitive"
+	pathTypeExact           = "exact"
+)
+
+func getPathType(ingEx *IngressEx) string {
+	pathType, exists := ingEx.Ingress.Annotations[pathRegexAnnotation]
+	if !exists {
+		return pathTypePrefix
+	}
+
+	switch pathType {
+	case pathTypeCaseSensitive, pathTypeCaseInsensitive, pathTypeExact:
+		return pathType
+	}
+
+	glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: got %q, must be %s, %s or %s, ignoring",
+		ingEx.Ingress.Namespace, ingEx.Ingress.Name, pathRegexAnnotation, pathType, pathTypeCaseSensitive, pathTypeCaseInsensitive, pathTypeExact)
+	return pathTypePrefix
+}
+
+// createLocationPath returns the match of the location for the path, e.g. `= /tea` for an exact path
+// or `~* "^/tea"` for a case insensitive regex
+func createLocationPath(path string, pathType string) (string, error) {
+	if strings.ContainsAny(path, "\"';") || strings.IndexFunc(path, isSpace) >= 0 {
+		return "", fmt.Errorf("Invalid path %q: must not contain whitespace or any of \"';", path)
+	}
+
+	// regexes are quoted, other paths must not contain braces
+	if pathType != pathTypeCaseSensitive && pathType != pathTypeCaseInsensitive && strings.ContainsAny(path, "{}") {
+		return "", fmt.Errorf("Invalid path %q: braces are only allowed in regex paths", path)
+	}
+
+	switch pathType {
+	case pathTypeCaseSensitive:
+		return fmt.Sprintf("~ \"^%s\"", path), nil
+	case pathTypeCaseInsensitive:
+		return fmt.Sprintf("~* \"^%s\"", path), nil
+	case pathTypeExact:
+		return fmt.Sprintf("= %s", path), nil
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("Invalid path %q: must start with /", path)
+	}
+	return path, nil
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// locationPriority returns the order in which locations are rendered:
+// exact locations first, then prefix locations and regex locations last
+func locationPriority(loc *Location) int {
+	switch {
+	case strings.HasPrefix(loc.Path, "= "):
+		return 0
+	case strings.HasPrefix(loc.Path, "~"):
+		return 2
+	}
+	return 1
+}
+
+// sortLocations sorts the locations of a server so that the precedence of their matching is predictable.
+// Prefix locations are sorted longest first, regex locations keep their order as NGINX
+// checks them in the order they appear.
+func sortLocations(locations []Location) {
+	sort.SliceStable(locations, func(i, j int) bool {
+		pi, pj := locationPriority(&locations[i]), locationPriority(&locations[j])
+		if pi != pj {
+			return pi < pj
+		}
+		if pi == 1 {
+			return len(locations[i].Path) > len(locations[j].Path)
+		}
+		return false
+	})
+}
+
+// findDuplicateLocation returns the path of a location that appears more than once in a server
+func findDuplicateLocation(locations []Location) (string, bool) {
+	seen := make(map[string]bool)
+	for _, loc := range locations {
+		if seen[loc.Path] {
+			return loc.Path, true
+		}
+		seen[loc.Path] = true
+	}
+	return "", false
+}
@@ -0,0 +1,135 @@
+package nginx
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	mirrorTargetAnnotation      = "nginx.org/mirror-target"
+	mirrorRequestBodyAnnotation = "nginx.org/mirror-request-body"
+)
+
+var serviceNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// GetMirrorBackend returns the shadow service of the nginx.org/mirror-target annotation,
+// or nil if the requests of the Ingress aren't mirrored to a service
+func GetMirrorBackend(ing *extensions.Ingress) *extensions.IngressBackend {
+	target, exists := ing.Annotations[mirrorTargetAnnotation]
+	if !exists || strings.Contains(target, "://") {
+		return nil
+	}
+	backend, err := parseMirrorService(target)
+	if err != nil {
+		return nil
+	}
+	return backend
+}
+
+// parseMirrorService parses a mirror target of the form <service>:<port>, where port is a number or a name
+func parseMirrorService(target string) (*extensions.IngressBackend, error) {
+	i := strings.LastIndex(target, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("%q must be <service>:<port> or an http or https URL", target)
+	}
+
+	name, port := target[:i], target[i+1:]
+	if !serviceNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("%q is not a valid service name", name)
+	}
+	if !serviceNameRegexp.MatchString(port) {
+		return nil, fmt.Errorf("%q is not a valid port", port)
+	}
+
+	return &extensions.IngressBackend{
+		ServiceName: name,
+		ServicePort: intstr.Parse(port),
+	}, nil
+}
+
+// getMirror returns the mirror of the requests of the Ingress or nil if they aren't mirrored.
+// Services are resolved through the endpoints of the Ingress, URLs are proxied to by their host.
+func (cnf *NgxConfig) getMirror(ingEx *IngressEx, cfg *Config) *Mirror {
+	target, exists := ingEx.Ingress.Annotations[mirrorTargetAnnotation]
+	if !exists {
+		return nil
+	}
+
+	requestBody := true
+	if enabled, exists, err := GetMapKeyAsBool(ingEx.Ingress.Annotations, mirrorRequestBodyAnnotation); err != nil {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, mirrorRequestBodyAnnotation, err)
+	} else if exists {
+		requestBody = enabled
+	}
+
+	if !strings.Contains(target, "://") {
+		backend, err := parseMirrorService(target)
+		if err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, mirrorTargetAnnotation, err)
+			return nil
+		}
+
+		name := fmt.Sprintf("%v-%v-mirror-%v-%v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, backend.ServiceName, backend.ServicePort.String())
+		return &Mirror{
+			Upstream:    cnf.createUpstream(ingEx, name, backend, ingEx.Ingress.Namespace, cfg),
+			Scheme:      "http",
+			Host:        "$host",
+			RequestBody: requestBody,
+		}
+	}
+
+	u, err := parseMirrorURL(target)
+	if err != nil {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, mirrorTargetAnnotation, err)
+		return nil
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	name := fmt.Sprintf("%v-%v-mirror", ingEx.Ingress.Namespace, ingEx.Ingress.Name)
+	return &Mirror{
+		Upstream: Upstream{
+			Name:     name,
+			LBMethod: cfg.LBMethod,
+			UpstreamServers: []UpstreamServer{{
+				Address:     u.Hostname(),
+				Port:        port,
+				MaxFails:    cfg.MaxFails,
+				FailTimeout: cfg.FailTimeout,
+			}},
+		},
+		Scheme:      u.Scheme,
+		Host:        u.Hostname(),
+		RequestBody: requestBody,
+	}
+}
+
+// parseMirrorURL ensures the URL only consists of a scheme, a host and a port,
+// as the mirrored requests keep their URI
+func parseMirrorURL(target string) (*url.URL, error) {
+	if err := validateRedirectURL(target); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return nil, fmt.Errorf("%q must not have a path, a query or user info", target)
+	}
+
+	return u, nil
+}
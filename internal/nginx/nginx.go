@@ -3,6 +3,7 @@ package nginx
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -13,22 +14,61 @@ import (
 
 // Controller updates NGINX configuration, starts and reloads NGINX
 type Controller struct {
-	nginxConfdPath   string
-	nginxSecretsPath string
-	local            bool
-	nginxBinaryPath  string
-	configVersion    int
+	nginxConfPath       string
+	nginxStagingPath    string
+	nginxConfdPath      string
+	nginxErrorPagesPath string
+	nginxSecretsPath    string
+	local               bool
+	nginxBinaryPath     string
+	// reloadPending is set when the applied configuration wasn't reloaded because the reload failed
+	reloadPending bool
 }
 
 // MainConfig describe the main NGINX configuration file
 type MainConfig struct {
+	HTTPPorts       []int
+	Resolver        string
+	ResolverValid   string
+	ProxyCacheZones []CacheZone
+	Gzip            bool
+	GzipLevel       int64
+	GzipMinLength   int64
+	GzipTypes       string
+	GzipProxied     string
+	GzipStatic      bool
+	StreamServers   []StreamServer
 }
 
 // Location describes an NGINX location
 type Location struct {
-	Path     string
-	Upstream Upstream
-	Rewrite  string
+	Path                     string
+	Upstream                 Upstream
+	Service                  string
+	RewriteRegex             string
+	RewriteTarget            string
+	ProxyRedirectFrom        string
+	ProxyRedirectTo          string
+	ProxyNextUpstream        string
+	ProxyNextUpstreamTries   int64
+	ProxyNextUpstreamTimeout string
+	ProxyConnectTimeout      string
+	ProxyReadTimeout         string
+	ProxySendTimeout         string
+	Return                   *Return
+	SSL                      bool
+	GRPC                     bool
+	WebSocket                bool
+	FastCGI                  bool
+	UpstreamVhost            string
+	ExternalName             string
+	ProxyCache               *ProxyCache
+}
+
+// Return describes the return directive of a location or a server
+type Return struct {
+	Code int64
+	URL  string
 }
 
 // Server describes an NGINX server
@@ -41,6 +81,7 @@ type Server struct {
 	SSLCertificate        string
 	SSLCertificateKey     string
 	SSLCiphers            string
+	GRPC                  bool
 	GRPCOnly              bool
 	StatusZone            string
 	HTTP2                 bool
@@ -58,14 +99,21 @@ type Server struct {
 	SetRealIPFrom   []string
 	RealIPRecursive bool
 
-	Ports    []int
-	SSLPorts []int
+	DefaultServer bool
+	ServerAliases []string
+	Ports         []int
+	SSLPorts      []int
+
+	AppRoot string
+	Return  *Return
 }
 
 // Upstream describes an NGINX upstream
 type Upstream struct {
 	Name            string
 	UpstreamServers []UpstreamServer
+	LBMethod        string
+	NoEndpoints     bool
 }
 
 // UpstreamServer describes a server in an NGINX upstream
@@ -74,7 +122,6 @@ type UpstreamServer struct {
 	Port        string
 	MaxFails    int64
 	FailTimeout string
-	SlowStart   string
 }
 
 // Ingress holds information about an Ingress resource
@@ -86,19 +133,50 @@ type Ingress struct {
 
 // IngressNginxConfig describes an NGINX configuration
 type IngressNginxConfig struct {
-	Upstreams []Upstream
-	Servers   []Server
-	Keepalive string
-	Ingress   Ingress
+	Upstreams      []Upstream
+	Servers        []Server
+	Keepalive      string
+	Ingress        Ingress
+	ErrorPages     []ErrorPage
+	ErrorPagesPath string
+	Mirror         *Mirror
+	Gzip           *Gzip
+	FastCGIParams  []FastCGIParam
+}
+
+// FastCGIParam describes a fastcgi_param passed to the FastCGI backends
+type FastCGIParam struct {
+	Name  string
+	Value string
+}
+
+// Mirror describes where the requests of an Ingress are mirrored to
+type Mirror struct {
+	Upstream    Upstream
+	Scheme      string
+	Host        string
+	RequestBody bool
+}
+
+// ErrorPage describes a custom error page served for a status code
+type ErrorPage struct {
+	Code int64
+	Body []byte
 }
 
 // NewNginxController creates a NGINX controller
 func NewNginxController(nginxConfPath string, nginxBinaryPath string, local bool) *Controller {
 	ngxc := Controller{
-		nginxConfdPath:  path.Join(nginxConfPath, "conf.d"),
-		local:           local,
-		nginxBinaryPath: nginxBinaryPath,
-		configVersion:   0,
+		nginxConfPath:       path.Clean(nginxConfPath),
+		nginxStagingPath:    path.Join(nginxConfPath, stagingDir),
+		nginxConfdPath:      path.Join(nginxConfPath, stagingDir, confdDir),
+		nginxErrorPagesPath: path.Join(nginxConfPath, "error-pages"),
+		nginxSecretsPath:    path.Join(nginxConfPath, "secrets"),
+		local:               local,
+		nginxBinaryPath:     nginxBinaryPath,
+	}
+	if !local {
+		ngxc.initStaging()
 	}
 
 	return &ngxc
@@ -131,31 +209,52 @@ func shellOut(cmd string) (err error) {
 	return nil
 }
 
-// Reload nginx
-func (nginx *Controller) Reload() error {
-	log.Printf("Reloading nginx. configVersion")
+// Reload applies the staged configuration and reloads nginx if any file changed, or if the last reload failed.
+// It returns whether nginx was reloaded and the errors of the configuration NGINX rejects, see Apply.
+func (nginx *Controller) Reload() (bool, map[string]error, error) {
+	applied, rejected, err := nginx.Apply()
+	if len(applied) == 0 && !nginx.reloadPending && !nginx.local {
+		log.Printf("No valid change of the configuration, skipping the reload of nginx")
+		return false, rejected, err
+	}
+
+	log.Printf("Reloading nginx with %v changed configuration files, %v rejected", len(applied), len(rejected))
 
 	reloadCmd := nginx.getNginxCommand("reload")
-	if err := shellOut(reloadCmd); err != nil {
-		return fmt.Errorf("nginx reload failed: %v", err)
+	if reloadErr := shellOut(reloadCmd); reloadErr != nil {
+		nginx.reloadPending = true
+		return true, rejected, fmt.Errorf("nginx reload failed: %v", reloadErr)
 	}
-	return nil
+	nginx.reloadPending = false
+	return true, rejected, err
+}
+
+// ReloadPending reports whether the applied configuration is waiting for a reload after a failed one
+func (nginx *Controller) ReloadPending() bool {
+	return nginx.reloadPending
 }
 
+// The address of the default backend, which responds to the requests for the services without endpoints
+const (
+	DefaultServerAddress = "127.0.0.1"
+	DefaultServerPort    = "8181"
+)
+
 // NewUpstreamWithDefaultServer creates an upstream with the default server.
-// proxy_pass to an upstream with the default server returns 502.
+// proxy_pass to an upstream with the default server returns 503.
 // We use it for services that have no endpoints
 func NewUpstreamWithDefaultServer(name string) Upstream {
 	return Upstream{
 		Name: name,
 		UpstreamServers: []UpstreamServer{
 			UpstreamServer{
-				Address:     "127.0.0.1",
-				Port:        "8181",
+				Address:     DefaultServerAddress,
+				Port:        DefaultServerPort,
 				MaxFails:    1,
 				FailTimeout: "10s",
 			},
 		},
+		NoEndpoints: true,
 	}
 }
 
@@ -163,7 +262,7 @@ func (nginx *Controller) getIngressNginxConfigFileName(name string) string {
 	return path.Join(nginx.nginxConfdPath, name+".conf")
 }
 
-// UpdateIngressConfigFile writes the Ingress configuration file to the filesystem
+// UpdateIngressConfigFile writes the Ingress configuration file to the staging directory
 func (nginx *Controller) UpdateIngressConfigFile(name string, cfg []byte) {
 	filename := nginx.getIngressNginxConfigFileName(name)
 	glog.V(3).Infof("Writing Ingress conf to %v", filename)
@@ -187,7 +286,7 @@ func (nginx *Controller) UpdateIngressConfigFile(name string, cfg []byte) {
 }
 
 // DeleteIngress deletes the configuration file, which corresponds for the
-// specified ingress from NGINX conf directory
+// specified ingress from the staging conf directory
 func (nginx *Controller) DeleteIngress(name string) {
 	filename := nginx.getIngressNginxConfigFileName(name)
 	glog.V(3).Infof("deleting %v", filename)
@@ -199,9 +298,73 @@ func (nginx *Controller) DeleteIngress(name string) {
 	}
 }
 
-// UpdateMainConfigFile writes the main NGINX configuration file to the filesystem
+// AddOrUpdateCertAndKey writes the certificate and the key of a TLS secret to a pem file
+// and returns the name of the file. The file is named after its content, see getContentHash.
+func (nginx *Controller) AddOrUpdateCertAndKey(name string, cert string, key string) string {
+	content := []byte(cert + "\n" + key)
+	pemFileName := path.Join(nginx.nginxSecretsPath, name+"-"+getContentHash(content))
+	glog.V(3).Infof("Writing certificate and key to %v", pemFileName)
+
+	if nginx.local {
+		return pemFileName
+	}
+	if _, err := os.Stat(pemFileName); err == nil {
+		return pemFileName
+	}
+
+	tmp := pemFileName + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		glog.Fatalf("Failed to write to %v: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, pemFileName); err != nil {
+		glog.Fatalf("Failed to rename %v to %v: %v", tmp, pemFileName, err)
+	}
+	return pemFileName
+}
+
+// UpdateErrorPagesFiles writes the custom error pages of the Ingress to the filesystem and returns
+// the directory they are written to. The directory is named after the pages, see getContentHash.
+func (nginx *Controller) UpdateErrorPagesFiles(name string, pages []ErrorPage) string {
+	var content bytes.Buffer
+	for _, page := range pages {
+		fmt.Fprintf(&content, "%d %d\n", page.Code, len(page.Body))
+		content.Write(page.Body)
+	}
+	dir := path.Join(nginx.nginxErrorPagesPath, name+"-"+getContentHash(content.Bytes()))
+	glog.V(3).Infof("Writing error pages to %v", dir)
+
+	if nginx.local || len(pages) == 0 {
+		return dir
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		glog.Warningf("Failed to delete %v: %v", tmp, err)
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		glog.Fatalf("Failed to create %v: %v", tmp, err)
+	}
+	for _, page := range pages {
+		filename := path.Join(tmp, fmt.Sprintf("%d.html", page.Code))
+		if err := ioutil.WriteFile(filename, page.Body, 0644); err != nil {
+			glog.Fatalf("Failed to write to %v: %v", filename, err)
+		}
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		glog.Fatalf("Failed to rename %v to %v: %v", tmp, dir, err)
+	}
+	return dir
+}
+
+// UpdateMainConfigFile writes the main NGINX configuration file to the staging directory
 func (nginx *Controller) UpdateMainConfigFile(cfg []byte) {
-	filename := "/etc/nginx/nginx.conf"
+	if nginx.local {
+		return
+	}
+	filename := path.Join(nginx.nginxStagingPath, mainConfigFile)
 	log.Printf("Writing NGINX conf to %v", filename)
 
 	w, err := os.Create(filename)
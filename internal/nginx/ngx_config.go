@@ -4,43 +4,158 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/metrics"
 	"github.com/golang/glog"
+	api_v1 "k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // NgxConfig transforms ingress to nginx config
 type NgxConfig struct {
-	nginx            *Controller
-	ingresses        map[string]*IngressEx
+	nginx     *Controller
+	config    *Config
+	ingresses map[string]*IngressEx
+	// defaultServerIngresses holds the Ingresses with rules without a host, which compete for the default server
+	defaultServerIngresses map[string]*IngressEx
+	// listenPorts and sslListenPorts hold the plain HTTP and the HTTPS ports of the Ingresses
+	listenPorts      map[string][]int
+	sslListenPorts   map[string][]int
+	streams          []StreamServiceEx
 	templateExecutor *TemplateExecutor
+	reloads          *reloadScheduler
+	// pending holds the Ingresses written since the last reload, and ingressErrors
+	// the errors of the Ingresses whose last configuration NGINX rejected, by file name
+	pending             map[string]bool
+	ingressErrors       map[string]string
+	ingressErrorHandler func(ing *extensions.Ingress, err error)
+	// lock guards the state and the files of the configuration, which aren't reloaded while they are written
+	lock sync.Mutex
 }
 
 // NewNgxConfig create new NgxConfig
-func NewNgxConfig(nginx *Controller, templateExecutor *TemplateExecutor) *NgxConfig {
+func NewNgxConfig(nginx *Controller, config *Config, templateExecutor *TemplateExecutor) *NgxConfig {
 	cnf := NgxConfig{
-		nginx:            nginx,
-		templateExecutor: templateExecutor,
-		ingresses:        make(map[string]*IngressEx),
+		nginx:                  nginx,
+		config:                 config,
+		templateExecutor:       templateExecutor,
+		ingresses:              make(map[string]*IngressEx),
+		defaultServerIngresses: make(map[string]*IngressEx),
+		listenPorts:            make(map[string][]int),
+		sslListenPorts:         make(map[string][]int),
+		pending:                make(map[string]bool),
+		ingressErrors:          make(map[string]string),
 	}
+	cnf.reloads = newReloadScheduler(cnf.reload)
 	return &cnf
 }
 
-// AddOrUpdateIngress add or update ingress
+// SetIngressErrorHandler sets the function called when NGINX rejects the configuration of an Ingress
+func (cnf *NgxConfig) SetIngressErrorHandler(handler func(ing *extensions.Ingress, err error)) {
+	cnf.ingressErrorHandler = handler
+}
+
+// reload reloads NGINX once the files being written are complete. The Ingresses whose configuration
+// NGINX rejects keep their last valid one and are reported to the Ingress error handler.
+// It returns whether NGINX was reloaded.
+func (cnf *NgxConfig) reload() (bool, error) {
+	cnf.lock.Lock()
+	pending := cnf.pending
+	cnf.pending = make(map[string]bool)
+
+	reloaded, rejected, err := cnf.nginx.Reload()
+
+	type ingressError struct {
+		ing *extensions.Ingress
+		err error
+	}
+	var newErrors []ingressError
+	for name, ingErr := range rejected {
+		ingEx, exists := cnf.ingresses[name]
+		if !exists || cnf.ingressErrors[name] == ingErr.Error() {
+			continue
+		}
+		cnf.ingressErrors[name] = ingErr.Error()
+		newErrors = append(newErrors, ingressError{ingEx.Ingress, ingErr})
+	}
+	if reloaded {
+		for name := range pending {
+			if _, isRejected := rejected[name]; !isRejected {
+				delete(cnf.ingressErrors, name)
+			}
+		}
+	} else if err != nil {
+		// the changes stay staged and are applied with the next ones
+		for name := range pending {
+			cnf.pending[name] = true
+		}
+	}
+	metrics.RejectedIngresses.Set(int64(len(cnf.ingressErrors)))
+	cnf.lock.Unlock()
+
+	if cnf.nginx.ReloadPending() {
+		// the changes are applied but NGINX still runs the previous configuration, the reload is retried
+		// after the minimum interval of the reload scheduler
+		cnf.reloads.markDirty()
+	}
+
+	if cnf.ingressErrorHandler != nil {
+		for _, e := range newErrors {
+			cnf.ingressErrorHandler(e.ing, e.err)
+		}
+	}
+	return reloaded, err
+}
+
+// RunReloads applies the changes of the configuration, coalescing them into as few reloads as possible,
+// until stopCh is closed. See reloadScheduler.
+func (cnf *NgxConfig) RunReloads(minInterval time.Duration, maxDelay time.Duration, stopCh <-chan struct{}) {
+	cnf.reloads.run(minInterval, maxDelay, stopCh)
+}
+
+// AddOrUpdateIngress add or update ingress. NGINX is reloaded by the reload scheduler.
 func (cnf *NgxConfig) AddOrUpdateIngress(ingEx *IngressEx) error {
-	nginxCfg := cnf.generateNginxCfg(ingEx)
+	cnf.lock.Lock()
+	defer cnf.lock.Unlock()
+
+	if err := cnf.addOrUpdateIngress(ingEx); err != nil {
+		return err
+	}
+	cnf.reloads.markDirty()
+	return nil
+}
+
+func (cnf *NgxConfig) addOrUpdateIngress(ingEx *IngressEx) error {
 	name := objectMetaToFileName(&ingEx.Ingress.ObjectMeta)
+	owner := cnf.getDefaultServerIngress()
+	cnf.setDefaultServerIngress(name, ingEx)
+
+	err := cnf.writeIngress(name, ingEx)
+	if defaultServerErr := cnf.updateDefaultServer(owner, name); err == nil {
+		err = defaultServerErr
+	}
+	return err
+}
+
+// writeIngress generates the configuration file of the Ingress
+func (cnf *NgxConfig) writeIngress(name string, ingEx *IngressEx) error {
+	pems := cnf.updateSecrets(ingEx)
+	nginxCfg, err := cnf.generateNginxCfg(ingEx, pems)
+	if err != nil {
+		return fmt.Errorf("Error generating Ingress Config %v: %v", name, err)
+	}
+	nginxCfg.ErrorPagesPath = cnf.nginx.UpdateErrorPagesFiles(name, nginxCfg.ErrorPages)
 	content, err := cnf.templateExecutor.ExecuteIngressConfigTemplate(&nginxCfg)
 	if err != nil {
 		return fmt.Errorf("Error generating Ingress Config %v: %v", name, err)
 	}
 	cnf.nginx.UpdateIngressConfigFile(name, content)
 	cnf.ingresses[name] = ingEx
-	if err := cnf.nginx.Reload(); err != nil {
-		return fmt.Errorf("Error reloading NGINX for %v/%v: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, err)
-	}
-	return nil
+	cnf.pending[name] = true
+	return cnf.updateListenPorts(name, getHTTPPorts(&nginxCfg), getSSLPorts(&nginxCfg))
 }
 
 func objectMetaToFileName(meta *meta_v1.ObjectMeta) string {
@@ -48,33 +163,91 @@ func objectMetaToFileName(meta *meta_v1.ObjectMeta) string {
 }
 
 func getNameForUpstream(ing *extensions.Ingress, host string, backend *extensions.IngressBackend) string {
+	host = strings.Replace(host, "*", "wildcard", 1)
 	return fmt.Sprintf("%v-%v-%v-%v-%v", ing.Namespace, ing.Name, host, backend.ServiceName, backend.ServicePort.String())
 }
 
-func (cnf *NgxConfig) generateNginxCfg(ingEx *IngressEx) IngressNginxConfig {
+// updateSecrets writes the TLS secrets of the Ingress to pem files
+// and returns the names of the files by host
+func (cnf *NgxConfig) updateSecrets(ingEx *IngressEx) map[string]string {
+	pems := make(map[string]string)
+
+	for _, tls := range ingEx.Ingress.Spec.TLS {
+		secret, exists := ingEx.TLSSecrets[tls.SecretName]
+		if !exists {
+			continue
+		}
+
+		name := ingEx.Ingress.Namespace + "-" + tls.SecretName
+		pemFileName := cnf.nginx.AddOrUpdateCertAndKey(name, string(secret.Data[api_v1.TLSCertKey]), string(secret.Data[api_v1.TLSPrivateKeyKey]))
+
+		for _, host := range tls.Hosts {
+			pems[host] = pemFileName
+		}
+	}
+
+	return pems
+}
+
+func (cnf *NgxConfig) generateNginxCfg(ingEx *IngressEx, pems map[string]string) (IngressNginxConfig, error) {
+	ingCfg := parseAnnotations(ingEx, cnf.config)
+
 	upstreams := make(map[string]Upstream)
 	rewrites := getRewrites(ingEx)
+	rewriteTarget := getRewriteTarget(ingEx)
+	pathType := getPathType(ingEx)
+	redirect := getRedirect(ingEx)
+	grpcServices := getServicesFromAnnotation(ingEx, grpcServicesAnnotation)
+	sslServices := getServicesFromAnnotation(ingEx, sslServicesAnnotation)
+	websocketServices := getServicesFromAnnotation(ingEx, websocketServicesAnnotation)
+	backendProtocol := getBackendProtocol(ingEx)
+	upstreamVhost := getUpstreamVhost(ingEx)
+
+	proxyCache := getProxyCache(ingEx, &ingCfg)
+
+	mirror := cnf.getMirror(ingEx, &ingCfg)
+	if mirror != nil {
+		upstreams[mirror.Upstream.Name] = mirror.Upstream
+	}
 
-	if ingEx.Ingress.Spec.Backend != nil {
+	if backend := ingEx.Ingress.Spec.Backend; backend != nil && !isExternalName(ingEx, backend.ServiceName+backend.ServicePort.String()) {
 		name := getNameForUpstream(ingEx.Ingress, "", ingEx.Ingress.Spec.Backend)
-		upstream := cnf.createUpstream(ingEx, name, ingEx.Ingress.Spec.Backend, ingEx.Ingress.Namespace)
+		upstream := cnf.createUpstream(ingEx, name, ingEx.Ingress.Spec.Backend, ingEx.Ingress.Namespace, &ingCfg)
 		upstreams[name] = upstream
 	}
 
 	var servers []Server
+	httpPorts := getListenPorts(ingEx, listenPortsAnnotation, []int{int(ingCfg.HTTPPort)})
+	sslPorts := getListenPorts(ingEx, listenPortsSSLAnnotation, []int{int(ingCfg.HTTPSPort)})
+	serverAliases := getServerAliases(ingEx)
 
-	for _, rule := range ingEx.Ingress.Spec.Rules {
-		if rule.IngressRuleValue.HTTP == nil {
+	for _, rule := range mergeRulesByHost(ingEx) {
+		serverName, defaultServer, skip, err := cnf.getServerName(ingEx, rule.Host)
+		if err != nil {
+			return IngressNginxConfig{}, fmt.Errorf("Error in the rule for host %q: %v", rule.Host, err)
+		}
+		if skip {
 			continue
 		}
 
-		serverName := rule.Host
-
 		statuzZone := rule.Host
 
 		server := Server{
-			Name:       serverName,
-			StatusZone: statuzZone,
+			Name:          serverName,
+			StatusZone:    statuzZone,
+			AppRoot:       getAppRoot(ingEx),
+			DefaultServer: defaultServer,
+		}
+		// a server name can only belong to one server, so the aliases go to the first server of the Ingress
+		if !defaultServer {
+			server.ServerAliases = serverAliases
+			serverAliases = nil
+		}
+
+		if pemFile, exists := pems[rule.Host]; exists {
+			server.SSL = true
+			server.SSLCertificate = pemFile
+			server.SSLCertificateKey = pemFile
 		}
 
 		var locations []Location
@@ -82,13 +255,32 @@ func (cnf *NgxConfig) generateNginxCfg(ingEx *IngressEx) IngressNginxConfig {
 
 		for _, path := range rule.HTTP.Paths {
 			upsName := getNameForUpstream(ingEx.Ingress, rule.Host, &path.Backend)
+			svcPort := path.Backend.ServiceName + path.Backend.ServicePort.String()
 
-			if _, exists := upstreams[upsName]; !exists {
-				upstream := cnf.createUpstream(ingEx, upsName, &path.Backend, ingEx.Ingress.Namespace)
+			if _, exists := upstreams[upsName]; !exists && !isExternalName(ingEx, svcPort) {
+				upstream := cnf.createUpstream(ingEx, upsName, &path.Backend, ingEx.Ingress.Namespace, &ingCfg)
 				upstreams[upsName] = upstream
 			}
 
-			loc := createLocation(pathOrDefault(path.Path), upstreams[upsName], rewrites[path.Backend.ServiceName])
+			locPath, err := createLocationPath(pathOrDefault(path.Path), pathType)
+			if err != nil {
+				return IngressNginxConfig{}, fmt.Errorf("Error in the rule for host %q: %v", rule.Host, err)
+			}
+
+			svcName := path.Backend.ServiceName
+			loc := createLocation(locPath, upstreams[upsName], &path.Backend, &ingCfg, sslServices[svcName], grpcServices[svcName], websocketServices[svcName])
+			loc.Return = redirect
+			loc.UpstreamVhost = upstreamVhost
+			setLocationProtocol(&loc, ingEx, backendProtocol, svcPort)
+			if !loc.GRPC && !loc.WebSocket && !loc.FastCGI {
+				loc.ProxyCache = proxyCache
+			}
+			if err := setLocationRewrite(&loc, pathOrDefault(path.Path), pathType, rewrites[path.Backend.ServiceName], rewriteTarget); err != nil {
+				return IngressNginxConfig{}, fmt.Errorf("Error in the rule for host %q: %v", rule.Host, err)
+			}
+			if err := setLocationExternalName(&loc, ingEx, svcPort); err != nil {
+				return IngressNginxConfig{}, fmt.Errorf("Error in the rule for host %q: %v", rule.Host, err)
+			}
 
 			locations = append(locations, loc)
 
@@ -100,27 +292,74 @@ func (cnf *NgxConfig) generateNginxCfg(ingEx *IngressEx) IngressNginxConfig {
 		if rootLocation == false && ingEx.Ingress.Spec.Backend != nil {
 			upsName := getNameForUpstream(ingEx.Ingress, "", ingEx.Ingress.Spec.Backend)
 
-			loc := createLocation(pathOrDefault("/"), upstreams[upsName], rewrites[ingEx.Ingress.Spec.Backend.ServiceName])
+			backend := ingEx.Ingress.Spec.Backend
+			loc := createLocation(pathOrDefault("/"), upstreams[upsName], backend, &ingCfg, sslServices[backend.ServiceName], grpcServices[backend.ServiceName], websocketServices[backend.ServiceName])
+			loc.Return = redirect
+			loc.UpstreamVhost = upstreamVhost
+			setLocationProtocol(&loc, ingEx, backendProtocol, backend.ServiceName+backend.ServicePort.String())
+			if !loc.GRPC && !loc.WebSocket && !loc.FastCGI {
+				loc.ProxyCache = proxyCache
+			}
+			if err := setLocationRewrite(&loc, "/", pathTypePrefix, rewrites[ingEx.Ingress.Spec.Backend.ServiceName], rewriteTarget); err != nil {
+				return IngressNginxConfig{}, fmt.Errorf("Error in the default backend: %v", err)
+			}
+			if err := setLocationExternalName(&loc, ingEx, backend.ServiceName+backend.ServicePort.String()); err != nil {
+				return IngressNginxConfig{}, fmt.Errorf("Error in the default backend: %v", err)
+			}
 			locations = append(locations, loc)
 		}
 
+		if path, exists := findDuplicateLocation(locations); exists {
+			return IngressNginxConfig{}, fmt.Errorf("Duplicate path %q in the rule for host %q", path, rule.Host)
+		}
+		sortLocations(locations)
+
 		server.Locations = locations
 
+		if err := setServerGRPC(&server); err != nil {
+			return IngressNginxConfig{}, fmt.Errorf("Error in the rule for host %q: %v", rule.Host, err)
+		}
+
+		// gRPC clients connect over TLS only, so the plain HTTP listener is dropped for gRPC only servers
+		if !server.GRPCOnly {
+			server.Ports = httpPorts
+		}
+		if server.SSL {
+			server.SSLPorts = sslPorts
+		}
+
 		servers = append(servers, server)
+
+		if wwwServer := createWWWRedirectServer(ingEx, rule.Host); wwwServer != nil && !isWildcardHost(rule.Host) {
+			wwwServer.Ports = httpPorts
+			servers = append(servers, *wwwServer)
+		}
+	}
+
+	var keepalive string
+	if ingCfg.Keepalive > 0 {
+		keepalive = fmt.Sprint(ingCfg.Keepalive)
 	}
+
 	return IngressNginxConfig{
-		Upstreams: upstreamMapToSlice(upstreams),
-		Servers:   servers,
+		Upstreams:     upstreamMapToSlice(upstreams),
+		Servers:       servers,
+		Keepalive:     keepalive,
+		ErrorPages:    getErrorPages(ingEx),
+		Mirror:        mirror,
+		Gzip:          getGzip(ingEx, &ingCfg),
+		FastCGIParams: getFastCGIParams(ingEx),
 		Ingress: Ingress{
 			Name:        ingEx.Ingress.Name,
 			Namespace:   ingEx.Ingress.Namespace,
 			Annotations: ingEx.Ingress.Annotations,
 		},
-	}
+	}, nil
 }
 
-func (cnf *NgxConfig) createUpstream(ingEx *IngressEx, name string, backend *extensions.IngressBackend, namespace string) Upstream {
+func (cnf *NgxConfig) createUpstream(ingEx *IngressEx, name string, backend *extensions.IngressBackend, namespace string, cfg *Config) Upstream {
 	ups := NewUpstreamWithDefaultServer(name)
+	ups.LBMethod = cfg.LBMethod
 
 	endps, exists := ingEx.Endpoints[backend.ServiceName+backend.ServicePort.String()]
 	if exists {
@@ -128,12 +367,15 @@ func (cnf *NgxConfig) createUpstream(ingEx *IngressEx, name string, backend *ext
 		for _, endp := range endps {
 			addressport := strings.Split(endp, ":")
 			upsServers = append(upsServers, UpstreamServer{
-				Address: addressport[0],
-				Port:    addressport[1],
+				Address:     addressport[0],
+				Port:        addressport[1],
+				MaxFails:    cfg.MaxFails,
+				FailTimeout: cfg.FailTimeout,
 			})
 		}
 		if len(upsServers) > 0 {
 			ups.UpstreamServers = upsServers
+			ups.NoEndpoints = false
 		}
 	}
 	return ups
@@ -141,17 +383,49 @@ func (cnf *NgxConfig) createUpstream(ingEx *IngressEx, name string, backend *ext
 
 // DeleteIngress deletes NGINX configuration for the Ingress resource
 func (cnf *NgxConfig) DeleteIngress(key string) error {
+	cnf.lock.Lock()
+	defer cnf.lock.Unlock()
+
 	name := strings.Replace(key, "/", "-", -1)
+	owner := cnf.getDefaultServerIngress()
+	cnf.setDefaultServerIngress(name, nil)
+
+	err := cnf.removeIngress(name)
+	if defaultServerErr := cnf.updateDefaultServer(owner, name); err == nil {
+		err = defaultServerErr
+	}
+	cnf.reloads.markDirty()
+	return err
+}
+
+// removeIngress deletes the configuration files of the Ingress
+func (cnf *NgxConfig) removeIngress(name string) error {
 	cnf.nginx.DeleteIngress(name)
 	delete(cnf.ingresses, name)
-	return nil
+	delete(cnf.ingressErrors, name)
+	return cnf.updateListenPorts(name, nil, nil)
 }
 
-func createLocation(path string, upstream Upstream, rewrite string) Location {
+func createLocation(path string, upstream Upstream, backend *extensions.IngressBackend, cfg *Config, ssl bool, grpc bool, websocket bool) Location {
 	loc := Location{
-		Path:     path,
-		Upstream: upstream,
-		Rewrite:  rewrite,
+		Path:                     path,
+		Upstream:                 upstream,
+		Service:                  backend.ServiceName + ":" + backend.ServicePort.String(),
+		ProxyNextUpstream:        cfg.ProxyNextUpstream,
+		ProxyNextUpstreamTries:   cfg.ProxyNextUpstreamTries,
+		ProxyNextUpstreamTimeout: cfg.ProxyNextUpstreamTimeout,
+		ProxyConnectTimeout:      cfg.ProxyConnectTimeout,
+		ProxyReadTimeout:         cfg.ProxyReadTimeout,
+		ProxySendTimeout:         cfg.ProxySendTimeout,
+		SSL:                      ssl,
+		GRPC:                     grpc,
+		WebSocket:                websocket,
+	}
+
+	// WebSocket connections stay idle for long, so they get the WebSocket timeouts
+	if websocket {
+		loc.ProxyReadTimeout = cfg.WebSocketReadTimeout
+		loc.ProxySendTimeout = cfg.WebSocketReadTimeout
 	}
 
 	return loc
@@ -186,59 +460,106 @@ func upstreamMapToSlice(upstreams map[string]Upstream) []Upstream {
 
 // UpdateEndpoints updates endpoints in NGINX configuration for the Ingress resources
 func (cnf *NgxConfig) UpdateEndpoints(ingExes []*IngressEx) error {
+	cnf.lock.Lock()
+	defer cnf.lock.Unlock()
+
+	// the Ingresses of the endpoints are a single change
+	defer cnf.reloads.markDirty()
+
 	for _, ingEx := range ingExes {
-		err := cnf.AddOrUpdateIngress(ingEx)
+		err := cnf.addOrUpdateIngress(ingEx)
 		if err != nil {
 			return fmt.Errorf("Error adding or updating ingress %v/%v: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, err)
 		}
 	}
 
-	if err := cnf.nginx.Reload(); err != nil {
-		return fmt.Errorf("Error reloading NGINX when updating endpoints: %v", err)
-	}
-
 	return nil
 }
 
-// HasIngress checks if the Ingress resource is present in NGINX configuration
-func (cnf *NgxConfig) HasIngress(ing *extensions.Ingress) bool {
-	name := objectMetaToFileName(&ing.ObjectMeta)
-	_, exists := cnf.ingresses[name]
-	return exists
+// GenerateMainConfig generates the configuration of the main NGINX configuration file
+func GenerateMainConfig(config *Config) *MainConfig {
+	return &MainConfig{
+		HTTPPorts:       []int{int(config.HTTPPort)},
+		Resolver:        config.Resolver,
+		ResolverValid:   config.ResolverValid,
+		ProxyCacheZones: config.ProxyCacheZones,
+		Gzip:            config.Gzip,
+		GzipLevel:       config.GzipLevel,
+		GzipMinLength:   config.GzipMinLength,
+		GzipTypes:       config.GzipTypes,
+		GzipProxied:     config.GzipProxied,
+		GzipStatic:      config.GzipStatic,
+	}
 }
 
-func getRewrites(ingEx *IngressEx) map[string]string {
-	rewrites := make(map[string]string)
+// updateMainConfig regenerates the main NGINX configuration file.
+// The default server also listens on the extra ports of the Ingresses, and the stream block
+// holds the TCP and UDP services.
+func (cnf *NgxConfig) updateMainConfig() error {
+	mainCfg := GenerateMainConfig(cnf.config)
+	mainCfg.HTTPPorts = append(mainCfg.HTTPPorts, cnf.getExtraListenPorts()...)
+	mainCfg.StreamServers = cnf.generateStreamServers(cnf.streams)
 
-	if services, exists := ingEx.Ingress.Annotations["nginx.org/rewrites"]; exists {
-		for _, svc := range strings.Split(services, ";") {
-			if serviceName, rewrite, err := parseRewrites(svc); err != nil {
-				glog.Errorf("In %v nginx.org/rewrites contains invalid declaration: %v, ignoring", ingEx.Ingress.Name, err)
-			} else {
-				rewrites[serviceName] = rewrite
-			}
-		}
+	content, err := cnf.templateExecutor.ExecuteMainConfigTemplate(mainCfg)
+	if err != nil {
+		return fmt.Errorf("Error generating NGINX main config: %v", err)
 	}
+	cnf.nginx.UpdateMainConfigFile(content)
+	return nil
+}
 
-	return rewrites
+// UpdateConfig updates the global NGINX configuration and regenerates the configuration
+// of the given Ingress resources with it. NGINX is reloaded by the reload scheduler.
+func (cnf *NgxConfig) UpdateConfig(config *Config, ingExes []*IngressEx) error {
+	cnf.lock.Lock()
+	defer cnf.lock.Unlock()
+
+	if err := cnf.updateConfig(config, ingExes); err != nil {
+		return err
+	}
+	cnf.reloads.markDirty()
+	return nil
 }
 
-func parseRewrites(service string) (serviceName string, rewrite string, err error) {
-	parts := strings.SplitN(strings.TrimSpace(service), " ", 2)
+func (cnf *NgxConfig) updateConfig(config *Config, ingExes []*IngressEx) error {
+	config.ProxyCacheZones = cnf.nginx.CreateCacheDirs(config.ProxyCacheZones)
+	cnf.config = config
 
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("Invalid rewrite format: %s", service)
+	if err := cnf.updateMainConfig(); err != nil {
+		return err
 	}
 
-	svcNameParts := strings.Split(parts[0], "=")
-	if len(svcNameParts) != 2 {
-		return "", "", fmt.Errorf("Invalid rewrite format: %s", svcNameParts)
+	// an invalid Ingress doesn't prevent the others from being updated
+	for _, ingEx := range ingExes {
+		if err := cnf.addOrUpdateIngress(ingEx); err != nil {
+			glog.Errorf("Error adding or updating ingress %v/%v: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, err)
+		}
 	}
 
-	rwPathParts := strings.Split(parts[1], "=")
-	if len(rwPathParts) != 2 {
-		return "", "", fmt.Errorf("Invalid rewrite format: %s", rwPathParts)
+	return nil
+}
+
+// Initialize generates the configuration of the Ingresses and the stream services
+// and reloads NGINX once, right away. It is used at startup, instead of syncing them one by one.
+func (cnf *NgxConfig) Initialize(config *Config, ingExes []*IngressEx, streams []StreamServiceEx) error {
+	cnf.lock.Lock()
+	cnf.streams = streams
+	err := cnf.updateConfig(config, ingExes)
+	cnf.reloads.markDirty()
+	cnf.lock.Unlock()
+
+	if err != nil {
+		return err
 	}
+	return cnf.reloads.flush()
+}
+
+// HasIngress checks if the Ingress resource is present in NGINX configuration
+func (cnf *NgxConfig) HasIngress(ing *extensions.Ingress) bool {
+	cnf.lock.Lock()
+	defer cnf.lock.Unlock()
 
-	return svcNameParts[1], rwPathParts[1], nil
+	name := objectMetaToFileName(&ing.ObjectMeta)
+	_, exists := cnf.ingresses[name]
+	return exists
 }
@@ -0,0 +1,186 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GetMapKeyAsBool tries to find and parse a key in the map as a bool.
+// The second return value reports whether the key exists.
+func GetMapKeyAsBool(m map[string]string, key string) (bool, bool, error) {
+	str, exists := m[key]
+	if !exists {
+		return false, false, nil
+	}
+
+	b, err := strconv.ParseBool(strings.TrimSpace(str))
+	if err != nil {
+		return false, true, fmt.Errorf("%s must be a boolean: %v", key, err)
+	}
+
+	return b, true, nil
+}
+
+// GetMapKeyAsInt64 tries to find and parse a key in the map as a non-negative int64.
+// The second return value reports whether the key exists.
+func GetMapKeyAsInt64(m map[string]string, key string) (int64, bool, error) {
+	str, exists := m[key]
+	if !exists {
+		return 0, false, nil
+	}
+
+	i, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("%s must be an integer: %v", key, err)
+	}
+	if i < 0 {
+		return 0, true, fmt.Errorf("%s must not be negative: got %d", key, i)
+	}
+
+	return i, true, nil
+}
+
+var nginxLBMethods = map[string]bool{
+	"least_conn":            true,
+	"ip_hash":               true,
+	"random":                true,
+	"random two":            true,
+	"random two least_conn": true,
+}
+
+// ParseLBMethod parses method and matches it to a corresponding load balancing method in NGINX.
+// An empty string is returned for round_robin, which is the NGINX default.
+// An error is returned if method is not valid.
+func ParseLBMethod(method string) (string, error) {
+	fields := strings.Fields(method)
+	method = strings.Join(fields, " ")
+
+	if method == "round_robin" {
+		return "", nil
+	}
+
+	if len(fields) > 0 && fields[0] == "hash" {
+		return parseHashLBMethod(fields)
+	}
+
+	if nginxLBMethods[method] {
+		return method, nil
+	}
+
+	return "", fmt.Errorf("Invalid load balancing method: %q", method)
+}
+
+// parseHashLBMethod validates the "hash <key> [consistent]" method.
+func parseHashLBMethod(fields []string) (string, error) {
+	method := strings.Join(fields, " ")
+
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", fmt.Errorf("Invalid load balancing method: %q, must be hash <key> [consistent]", method)
+	}
+	if len(fields) == 3 && fields[2] != "consistent" {
+		return "", fmt.Errorf("Invalid load balancing method: %q, must be hash <key> [consistent]", method)
+	}
+	if strings.ContainsAny(fields[1], ";{}'\"") {
+		return "", fmt.Errorf("Invalid hash key in load balancing method: %q", fields[1])
+	}
+
+	return method, nil
+}
+
+var timeRegexp = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|M|y)?)+$`)
+
+// ParseTime ensures that the string value is a valid NGINX time, e.g. 10s or 1m30s.
+func ParseTime(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !timeRegexp.MatchString(s) {
+		return "", fmt.Errorf("Invalid time: %q", s)
+	}
+	return s, nil
+}
+
+var nginxNextUpstreamConditions = map[string]bool{
+	"error":          true,
+	"timeout":        true,
+	"invalid_header": true,
+	"http_500":       true,
+	"http_502":       true,
+	"http_503":       true,
+	"http_504":       true,
+	"http_403":       true,
+	"http_404":       true,
+	"http_429":       true,
+	"non_idempotent": true,
+	"off":            true,
+}
+
+// ParseProxyNextUpstream ensures that the string value is a valid list of
+// proxy_next_upstream conditions, e.g. "error timeout http_502".
+func ParseProxyNextUpstream(s string) (string, error) {
+	conditions := strings.Fields(s)
+	if len(conditions) == 0 {
+		return "", fmt.Errorf("Invalid proxy_next_upstream: must not be empty")
+	}
+
+	for _, condition := range conditions {
+		if !nginxNextUpstreamConditions[condition] {
+			return "", fmt.Errorf("Invalid proxy_next_upstream condition: %q", condition)
+		}
+		if condition == "off" && len(conditions) > 1 {
+			return "", fmt.Errorf("Invalid proxy_next_upstream: off can't be combined with other conditions")
+		}
+	}
+
+	return strings.Join(conditions, " "), nil
+}
+
+var mimeTypeRegexp = regexp.MustCompile(`^([a-z0-9.+-]+/[a-zA-Z0-9.+*-]+|\*)$`)
+
+// ParseGzipTypes ensures that the string value is a valid list of MIME types separated by spaces or commas,
+// e.g. "text/css application/json"
+func ParseGzipTypes(s string) (string, error) {
+	types := strings.Fields(strings.Replace(s, ",", " ", -1))
+	if len(types) == 0 {
+		return "", fmt.Errorf("Invalid gzip_types: must not be empty")
+	}
+
+	for _, t := range types {
+		if !mimeTypeRegexp.MatchString(t) {
+			return "", fmt.Errorf("Invalid MIME type: %q", t)
+		}
+	}
+
+	return strings.Join(types, " "), nil
+}
+
+var nginxGzipProxiedConditions = map[string]bool{
+	"off":              true,
+	"expired":          true,
+	"no-cache":         true,
+	"no-store":         true,
+	"private":          true,
+	"no_last_modified": true,
+	"no_etag":          true,
+	"auth":             true,
+	"any":              true,
+}
+
+// ParseGzipProxied ensures that the string value is a valid list of gzip_proxied conditions, e.g. "expired no-cache"
+func ParseGzipProxied(s string) (string, error) {
+	conditions := strings.Fields(s)
+	if len(conditions) == 0 {
+		return "", fmt.Errorf("Invalid gzip_proxied: must not be empty")
+	}
+
+	for _, condition := range conditions {
+		if !nginxGzipProxiedConditions[condition] {
+			return "", fmt.Errorf("Invalid gzip_proxied condition: %q", condition)
+		}
+		if (condition == "off" || condition == "any") && len(conditions) > 1 {
+			return "", fmt.Errorf("Invalid gzip_proxied: %s can't be combined with other conditions", condition)
+		}
+	}
+
+	return strings.Join(conditions, " "), nil
+}
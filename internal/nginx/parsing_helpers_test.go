@@ -0,0 +1,50 @@
+package nginx
+
+import "testing"
+
+func TestParseLBMethod(t *testing.T) {
+	tests := []struct {
+		method   string
+		expected string
+	}{
+		{"round_robin", ""},
+		{"least_conn", "least_conn"},
+		{"ip_hash", "ip_hash"},
+		{"random", "random"},
+		{"random  two", "random two"},
+		{" random two least_conn ", "random two least_conn"},
+		{"hash $request_uri", "hash $request_uri"},
+		{"hash $request_uri consistent", "hash $request_uri consistent"},
+		{"hash  $remote_addr$request_uri   consistent", "hash $remote_addr$request_uri consistent"},
+	}
+
+	for _, test := range tests {
+		result, err := ParseLBMethod(test.method)
+		if err != nil {
+			t.Errorf("ParseLBMethod(%q) returned an error: %v", test.method, err)
+		}
+		if result != test.expected {
+			t.Errorf("ParseLBMethod(%q) returned %q, expected %q", test.method, result, test.expected)
+		}
+	}
+}
+
+func TestParseLBMethodFails(t *testing.T) {
+	methods := []string{
+		"",
+		"least_time",
+		"random three",
+		"hash",
+		"hash $request_uri inconsistent",
+		"hash $request_uri consistent extra",
+		"hash $request_uri;",
+		"hash {$request_uri}",
+		`hash "$request_uri"`,
+	}
+
+	for _, method := range methods {
+		if result, err := ParseLBMethod(method); err == nil {
+			t.Errorf("ParseLBMethod(%q) returned %q instead of an error", method, result)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const backendProtocolAnnotation = "nginx.org/backend-protocol"
+
+// Protocols of the nginx.org/backend-protocol annotation
+const (
+	protocolHTTP  = "HTTP"
+	protocolHTTPS = "HTTPS"
+	protocolGRPC  = "GRPC"
+	protocolGRPCS = "GRPCS"
+	protocolFCGI  = "FCGI"
+)
+
+var backendProtocols = map[string]bool{
+	protocolHTTP:  true,
+	protocolHTTPS: true,
+	protocolGRPC:  true,
+	protocolGRPCS: true,
+	protocolFCGI:  true,
+}
+
+var fastCGIParamNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// InferBackendProtocol returns the protocol of a service port from its name, e.g. https or grpc-api,
+// or an empty string if the name doesn't tell
+func InferBackendProtocol(portName string) string {
+	name := strings.ToUpper(portName)
+	if i := strings.IndexByte(name, '-'); i >= 0 {
+		name = name[:i]
+	}
+	if name == "FASTCGI" {
+		name = protocolFCGI
+	}
+	if backendProtocols[name] {
+		return name
+	}
+	return ""
+}
+
+// getBackendProtocol returns the protocol of the nginx.org/backend-protocol annotation,
+// or an empty string if the protocols are inferred from the ports of the services
+func getBackendProtocol(ingEx *IngressEx) string {
+	protocol, exists := ingEx.Ingress.Annotations[backendProtocolAnnotation]
+	if !exists {
+		return ""
+	}
+
+	protocol = strings.ToUpper(strings.TrimSpace(protocol))
+	if !backendProtocols[protocol] {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: got %q, must be one of HTTP, HTTPS, GRPC, GRPCS or FCGI, ignoring",
+			ingEx.Ingress.Namespace, ingEx.Ingress.Name, backendProtocolAnnotation, protocol)
+		return ""
+	}
+	return protocol
+}
+
+// setLocationProtocol sets up the location for the protocol of its backend: the annotation,
+// otherwise the protocol inferred from the service port. The nginx.org/ssl-services
+// and nginx.org/grpc-services annotations add to it.
+func setLocationProtocol(loc *Location, ingEx *IngressEx, protocol string, svcPort string) {
+	if protocol == "" {
+		protocol = ingEx.BackendProtocols[svcPort]
+	}
+
+	switch protocol {
+	case protocolHTTPS:
+		loc.SSL = true
+	case protocolGRPC:
+		loc.GRPC = true
+	case protocolGRPCS:
+		loc.GRPC = true
+		loc.SSL = true
+	case protocolFCGI:
+		loc.FastCGI = true
+		loc.ProxyNextUpstream = fastCGINextUpstream(loc.ProxyNextUpstream)
+	}
+}
+
+// fastCGINextUpstream drops the proxy_next_upstream conditions fastcgi_next_upstream doesn't support
+func fastCGINextUpstream(conditions string) string {
+	var supported []string
+	for _, condition := range strings.Fields(conditions) {
+		if condition != "http_502" && condition != "http_504" {
+			supported = append(supported, condition)
+		}
+	}
+	if len(supported) == 0 {
+		return "off"
+	}
+	return strings.Join(supported, " ")
+}
+
+// defaultScriptFilename is the SCRIPT_FILENAME param of the FastCGI services, which the standard fastcgi_params
+// doesn't set while PHP-FPM requires it
+const defaultScriptFilename = "$document_root$fastcgi_script_name"
+
+// getFastCGIParams returns the FastCGI params of the ConfigMap of the Ingress, sorted by name, with
+// the default SCRIPT_FILENAME unless the ConfigMap sets it. Params that can't be safely rendered are logged and ignored.
+func getFastCGIParams(ingEx *IngressEx) []FastCGIParam {
+	var params []FastCGIParam
+	scriptFilename := defaultScriptFilename
+
+	for name, value := range ingEx.FastCGIParams {
+		if err := validateFastCGIParam(name, value); err != nil {
+			glog.Errorf("Ingress %s/%s: Invalid FastCGI param: %v, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, err)
+			continue
+		}
+		if name == "SCRIPT_FILENAME" {
+			scriptFilename = value
+			continue
+		}
+		params = append(params, FastCGIParam{Name: name, Value: value})
+	}
+	params = append(params, FastCGIParam{Name: "SCRIPT_FILENAME", Value: scriptFilename})
+
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name < params[j].Name
+	})
+	return params
+}
+
+func validateFastCGIParam(name string, value string) error {
+	if !fastCGIParamNameRegexp.MatchString(name) {
+		return fmt.Errorf("%q must consist of letters, digits and underscores", name)
+	}
+	if strings.ContainsAny(value, "\"\\\n\r") {
+		return fmt.Errorf("the value of %v must not contain quotes, backslashes or line breaks", name)
+	}
+	return nil
+}
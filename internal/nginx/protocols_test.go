@@ -0,0 +1,50 @@
+package nginx
+
+import (
+	"reflect"
+	"testing"
+
+	extensions "k8s.io/api/extensions/v1beta1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetFastCGIParams(t *testing.T) {
+	tests := []struct {
+		msg      string
+		params   map[string]string
+		expected []FastCGIParam
+	}{
+		{
+			msg:    "no params",
+			params: nil,
+			expected: []FastCGIParam{
+				{Name: "SCRIPT_FILENAME", Value: "$document_root$fastcgi_script_name"},
+			},
+		},
+		{
+			msg:    "params with SCRIPT_FILENAME",
+			params: map[string]string{"SCRIPT_FILENAME": "/var/www/html$fastcgi_script_name", "APP_ENV": "production"},
+			expected: []FastCGIParam{
+				{Name: "APP_ENV", Value: "production"},
+				{Name: "SCRIPT_FILENAME", Value: "/var/www/html$fastcgi_script_name"},
+			},
+		},
+		{
+			msg:    "invalid params",
+			params: map[string]string{"SCRIPT_FILENAME": `/var/www/"html"`, "APP-ENV": "production"},
+			expected: []FastCGIParam{
+				{Name: "SCRIPT_FILENAME", Value: "$document_root$fastcgi_script_name"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ingEx := &IngressEx{
+			Ingress:       &extensions.Ingress{ObjectMeta: meta_v1.ObjectMeta{Namespace: "default", Name: "cafe"}},
+			FastCGIParams: test.params,
+		}
+		if params := getFastCGIParams(ingEx); !reflect.DeepEqual(params, test.expected) {
+			t.Errorf("getFastCGIParams() returned %+v for the case of %s, expected %+v", params, test.msg, test.expected)
+		}
+	}
+}
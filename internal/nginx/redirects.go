@@ -0,0 +1,115 @@
+package nginx
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	permanentRedirectAnnotation = "nginx.org/permanent-redirect"
+	temporaryRedirectAnnotation = "nginx.org/temporary-redirect"
+	redirectCodeAnnotation      = "nginx.org/redirect-code"
+	fromToWWWRedirectAnnotation = "nginx.org/from-to-www-redirect"
+)
+
+// getRedirect returns the redirect all the locations of the Ingress respond with,
+// or nil if the Ingress isn't redirected
+func getRedirect(ingEx *IngressEx) *Return {
+	annotations := ingEx.Ingress.Annotations
+
+	target, permanent := annotations[permanentRedirectAnnotation]
+	temporaryTarget, temporary := annotations[temporaryRedirectAnnotation]
+	if !permanent && !temporary {
+		return nil
+	}
+
+	validCodes := []int64{301, 308}
+	if permanent && temporary {
+		glog.Errorf("Ingress %s/%s: %s and %s can't be used together, using %s", ingEx.Ingress.Namespace, ingEx.Ingress.Name,
+			permanentRedirectAnnotation, temporaryRedirectAnnotation, permanentRedirectAnnotation)
+	} else if temporary {
+		target = temporaryTarget
+		validCodes = []int64{302, 307}
+	}
+
+	if err := validateRedirectURL(target); err != nil {
+		glog.Errorf("Ingress %s/%s: Invalid redirect URL: %v, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, err)
+		return nil
+	}
+
+	return &Return{
+		Code: getRedirectCode(ingEx, validCodes),
+		URL:  target,
+	}
+}
+
+// getRedirectCode returns the code of the nginx.org/redirect-code annotation if it's one of validCodes,
+// otherwise the first of validCodes
+func getRedirectCode(ingEx *IngressEx, validCodes []int64) int64 {
+	code, exists, err := GetMapKeyAsInt64(ingEx.Ingress.Annotations, redirectCodeAnnotation)
+	if !exists {
+		return validCodes[0]
+	}
+	if err == nil {
+		for _, valid := range validCodes {
+			if code == valid {
+				return code
+			}
+		}
+		err = fmt.Errorf("must be one of %v: got %v", validCodes, code)
+	}
+
+	glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v, using %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name,
+		redirectCodeAnnotation, err, validCodes[0])
+	return validCodes[0]
+}
+
+// createWWWRedirectServer returns the server redirecting from the www. variant of host to host
+// or the other way around, if the nginx.org/from-to-www-redirect annotation is enabled
+func createWWWRedirectServer(ingEx *IngressEx, host string) *Server {
+	enabled, exists, err := GetMapKeyAsBool(ingEx.Ingress.Annotations, fromToWWWRedirectAnnotation)
+	if err != nil {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v", ingEx.Ingress.Namespace, ingEx.Ingress.Name, fromToWWWRedirectAnnotation, err)
+	}
+	if !exists || !enabled || host == "" {
+		return nil
+	}
+
+	from := "www." + host
+	if strings.HasPrefix(host, "www.") {
+		from = strings.TrimPrefix(host, "www.")
+	}
+
+	return &Server{
+		Name:       from,
+		StatusZone: from,
+		Return: &Return{
+			Code: getRedirectCode(ingEx, []int64{301, 302, 307, 308}),
+			URL:  fmt.Sprintf("$scheme://%s$request_uri", host),
+		},
+	}
+}
+
+// validateRedirectURL ensures the URL is an absolute http or https URL
+// that can be safely rendered in a return directive
+func validateRedirectURL(target string) error {
+	if strings.ContainsAny(target, "\"';{}\\$") || strings.IndexFunc(target, isSpace) >= 0 {
+		return fmt.Errorf("%q must not contain whitespace or any of \"';{}\\$", target)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must be an http or https URL", target)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q must have a host", target)
+	}
+
+	return nil
+}
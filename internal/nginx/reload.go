@@ -0,0 +1,122 @@
+package nginx
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/metrics"
+	"github.com/golang/glog"
+)
+
+// Defaults of the reload scheduler
+const (
+	DefaultReloadMinInterval = 1 * time.Second
+	DefaultReloadMaxDelay    = 5 * time.Second
+)
+
+// reloadScheduler coalesces the changes of the configuration files into as few reloads of NGINX as possible.
+// A reload waits until no change happened for the minimum interval, but no longer than the maximum delay
+// after the first pending change, so reloads are at least the minimum interval apart.
+type reloadScheduler struct {
+	// reload applies the changes and returns whether NGINX was reloaded
+	reload func() (bool, error)
+
+	lock        sync.Mutex
+	changes     int
+	firstChange time.Time
+	lastChange  time.Time
+	notify      chan struct{}
+}
+
+func newReloadScheduler(reload func() (bool, error)) *reloadScheduler {
+	return &reloadScheduler{
+		reload: reload,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// markDirty records a change that requires a reload
+func (s *reloadScheduler) markDirty() {
+	s.lock.Lock()
+	now := time.Now()
+	if s.changes == 0 {
+		s.firstChange = now
+	}
+	s.lastChange = now
+	s.changes++
+	s.lock.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run reloads NGINX when changes are pending, until stopCh is closed
+func (s *reloadScheduler) run(minInterval time.Duration, maxDelay time.Duration, stopCh <-chan struct{}) {
+	if maxDelay < minInterval {
+		maxDelay = minInterval
+	}
+
+	for {
+		s.lock.Lock()
+		pending := s.changes > 0
+		due := s.lastChange.Add(minInterval)
+		if deadline := s.firstChange.Add(maxDelay); deadline.Before(due) {
+			due = deadline
+		}
+		s.lock.Unlock()
+
+		if !pending {
+			select {
+			case <-s.notify:
+			case <-stopCh:
+				return
+			}
+			continue
+		}
+
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-s.notify:
+			case <-stopCh:
+				return
+			}
+			continue
+		}
+
+		if err := s.flush(); err != nil {
+			glog.Errorf("Error reloading NGINX: %v", err)
+		}
+	}
+}
+
+// flush applies the pending changes right away. NGINX is only reloaded if the configuration files changed.
+func (s *reloadScheduler) flush() error {
+	s.lock.Lock()
+	changes := s.changes
+	s.changes = 0
+	s.lock.Unlock()
+
+	if changes == 0 {
+		return nil
+	}
+
+	log.Printf("Applying %v changes of the configuration", changes)
+	reloaded, err := s.reload()
+	if reloaded {
+		metrics.ReloadBatchSize.Set(int64(changes))
+		metrics.ReloadedChanges.Add(int64(changes))
+	}
+
+	if err != nil {
+		metrics.Reloads.Add("error", 1)
+		return err
+	}
+	if reloaded {
+		metrics.Reloads.Add("success", 1)
+	}
+	return nil
+}
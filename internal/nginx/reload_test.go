@@ -0,0 +1,178 @@
+package nginx
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feifeiiiiiiiiiii/mini-ingress-nginx/internal/metrics"
+)
+
+func TestReloadSchedulerRun(t *testing.T) {
+	const ms = time.Millisecond
+
+	tests := []struct {
+		msg         string
+		minInterval time.Duration
+		maxDelay    time.Duration
+		changes     []time.Duration
+		reloads     []time.Duration
+	}{
+		{
+			msg:         "a single change is reloaded after the minimum interval",
+			minInterval: 100 * ms,
+			maxDelay:    350 * ms,
+			changes:     []time.Duration{0},
+			reloads:     []time.Duration{100 * ms},
+		},
+		{
+			msg:         "a burst of changes is reloaded once, the minimum interval after the last change",
+			minInterval: 100 * ms,
+			maxDelay:    350 * ms,
+			changes:     []time.Duration{0, 40 * ms, 80 * ms, 120 * ms},
+			reloads:     []time.Duration{220 * ms},
+		},
+		{
+			msg:         "changes further apart than the minimum interval are reloaded separately",
+			minInterval: 100 * ms,
+			maxDelay:    350 * ms,
+			changes:     []time.Duration{0, 200 * ms},
+			reloads:     []time.Duration{100 * ms, 300 * ms},
+		},
+		{
+			msg:         "a steady flow of changes is reloaded at the maximum delay",
+			minInterval: 100 * ms,
+			maxDelay:    350 * ms,
+			changes:     []time.Duration{0, 80 * ms, 160 * ms, 240 * ms, 320 * ms, 400 * ms, 480 * ms, 560 * ms},
+			reloads:     []time.Duration{350 * ms, 660 * ms},
+		},
+		{
+			msg:         "a maximum delay shorter than the minimum interval is the minimum interval",
+			minInterval: 100 * ms,
+			maxDelay:    10 * ms,
+			changes:     []time.Duration{0, 50 * ms},
+			reloads:     []time.Duration{100 * ms},
+		},
+	}
+
+	for _, test := range tests {
+		var lock sync.Mutex
+		var reloads []time.Duration
+		start := time.Now()
+		s := newReloadScheduler(func() (bool, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			reloads = append(reloads, time.Since(start))
+			return true, nil
+		})
+
+		stopCh := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			s.run(test.minInterval, test.maxDelay, stopCh)
+			close(done)
+		}()
+
+		for _, change := range test.changes {
+			time.Sleep(time.Until(start.Add(change)))
+			s.markDirty()
+		}
+		time.Sleep(time.Until(start.Add(test.reloads[len(test.reloads)-1] + test.minInterval)))
+		close(stopCh)
+		<-done
+
+		lock.Lock()
+		if len(reloads) != len(test.reloads) {
+			t.Errorf("reloadScheduler.run() reloaded at %v for the case of %s, expected %v", reloads, test.msg, test.reloads)
+		} else {
+			for i := range reloads {
+				// the timers may fire late, but never early
+				if reloads[i] < test.reloads[i] || reloads[i] > test.reloads[i]+40*ms {
+					t.Errorf("reloadScheduler.run() reloaded at %v for the case of %s, expected %v", reloads, test.msg, test.reloads)
+					break
+				}
+			}
+		}
+		lock.Unlock()
+	}
+}
+
+func TestReloadSchedulerFlush(t *testing.T) {
+	tests := []struct {
+		msg             string
+		changes         int
+		reloaded        bool
+		err             error
+		expectedReloads int
+		expectedResults map[string]int64
+	}{
+		{
+			msg:             "no pending change",
+			changes:         0,
+			reloaded:        true,
+			expectedReloads: 0,
+			expectedResults: map[string]int64{"success": 0, "error": 0},
+		},
+		{
+			msg:             "pending changes",
+			changes:         3,
+			reloaded:        true,
+			expectedReloads: 1,
+			expectedResults: map[string]int64{"success": 1, "error": 0},
+		},
+		{
+			msg:             "pending changes that don't change the configuration",
+			changes:         2,
+			reloaded:        false,
+			expectedReloads: 1,
+			expectedResults: map[string]int64{"success": 0, "error": 0},
+		},
+		{
+			msg:             "pending changes that fail to reload",
+			changes:         1,
+			reloaded:        true,
+			err:             errors.New("nginx reload failed"),
+			expectedReloads: 1,
+			expectedResults: map[string]int64{"success": 0, "error": 1},
+		},
+	}
+
+	for _, test := range tests {
+		reloads := 0
+		s := newReloadScheduler(func() (bool, error) {
+			reloads++
+			return test.reloaded, test.err
+		})
+		for i := 0; i < test.changes; i++ {
+			s.markDirty()
+		}
+
+		before := map[string]int64{"success": getReloadsMetric("success"), "error": getReloadsMetric("error")}
+		err := s.flush()
+		if err != test.err {
+			t.Errorf("reloadScheduler.flush() returned %v for the case of %s, expected %v", err, test.msg, test.err)
+		}
+		if reloads != test.expectedReloads {
+			t.Errorf("reloadScheduler.flush() called reload %v times for the case of %s, expected %v", reloads, test.msg, test.expectedReloads)
+		}
+		for result, expected := range test.expectedResults {
+			if count := getReloadsMetric(result) - before[result]; count != expected {
+				t.Errorf("reloadScheduler.flush() counted %v %v reloads for the case of %s, expected %v", count, result, test.msg, expected)
+			}
+		}
+
+		// the changes are applied by the flush, so a second flush has nothing to do
+		if err := s.flush(); err != nil || reloads != test.expectedReloads {
+			t.Errorf("reloadScheduler.flush() reloaded again without any change for the case of %s", test.msg)
+		}
+	}
+}
+
+func getReloadsMetric(result string) int64 {
+	if count, ok := metrics.Reloads.Get(result).(*expvar.Int); ok {
+		return count.Value()
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	rewritesAnnotation      = "nginx.org/rewrites"
+	rewriteTargetAnnotation = "nginx.org/rewrite-target"
+	appRootAnnotation       = "nginx.org/app-root"
+)
+
+func getRewrites(ingEx *IngressEx) map[string]string {
+	rewrites := make(map[string]string)
+
+	if services, exists := ingEx.Ingress.Annotations[rewritesAnnotation]; exists {
+		for _, svc := range strings.Split(services, ";") {
+			if strings.TrimSpace(svc) == "" {
+				continue
+			}
+			if serviceName, rewrite, err := parseRewrites(svc); err != nil {
+				glog.Errorf("In %v nginx.org/rewrites contains invalid declaration: %v, ignoring", ingEx.Ingress.Name, err)
+			} else {
+				rewrites[serviceName] = rewrite
+			}
+		}
+	}
+
+	return rewrites
+}
+
+func parseRewrites(service string) (serviceName string, rewrite string, err error) {
+	parts := strings.SplitN(strings.TrimSpace(service), " ", 2)
+
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("Invalid rewrite format: %s", service)
+	}
+
+	svcNameParts := strings.SplitN(parts[0], "=", 2)
+	if len(svcNameParts) != 2 || svcNameParts[0] != "serviceName" {
+		return "", "", fmt.Errorf("Invalid rewrite format: %s", svcNameParts)
+	}
+
+	rwPathParts := strings.SplitN(strings.TrimSpace(parts[1]), "=", 2)
+	if len(rwPathParts) != 2 || rwPathParts[0] != "rewrite" {
+		return "", "", fmt.Errorf("Invalid rewrite format: %s", rwPathParts)
+	}
+
+	if err := validateURI(rwPathParts[1]); err != nil {
+		return "", "", err
+	}
+
+	return svcNameParts[1], rwPathParts[1], nil
+}
+
+// validateURI ensures the URI can be safely rendered as an argument of an NGINX directive
+func validateURI(uri string) error {
+	if !strings.HasPrefix(uri, "/") && !strings.HasPrefix(uri, "$") {
+		return fmt.Errorf("Invalid URI %q: must start with / or a capture", uri)
+	}
+	if strings.ContainsAny(uri, "\"';{}\\") || strings.IndexFunc(uri, isSpace) >= 0 {
+		return fmt.Errorf("Invalid URI %q: must not contain whitespace or any of \"';{}\\", uri)
+	}
+	return nil
+}
+
+func getRewriteTarget(ingEx *IngressEx) string {
+	target, exists := ingEx.Ingress.Annotations[rewriteTargetAnnotation]
+	if !exists {
+		return ""
+	}
+	if err := validateURI(target); err != nil {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %v, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, rewriteTargetAnnotation, err)
+		return ""
+	}
+	return target
+}
+
+func getAppRoot(ingEx *IngressEx) string {
+	appRoot, exists := ingEx.Ingress.Annotations[appRootAnnotation]
+	if !exists {
+		return ""
+	}
+	if err := validateURI(appRoot); err != nil || strings.Contains(appRoot, "$") {
+		glog.Errorf("Ingress %s/%s: Invalid value for the %s annotation: %q must be a path, ignoring", ingEx.Ingress.Namespace, ingEx.Ingress.Name, appRootAnnotation, appRoot)
+		return ""
+	}
+	return appRoot
+}
+
+var captureRegexp = regexp.MustCompile(`\$[0-9]`)
+
+// setLocationRewrite sets up the rewrite of the URI of the requests matched by the location.
+// rewrite comes from the nginx.org/rewrites annotation and replaces the prefix of a path.
+// target comes from the nginx.org/rewrite-target annotation and may refer to the captures of a regex path.
+// Redirects and cookies of the backend are mapped back from the rewritten prefix to the original one.
+func setLocationRewrite(loc *Location, path string, pathType string, rewrite string, target string) error {
+	switch {
+	case target == "" && rewrite == "":
+		return nil
+	case target == "":
+		if pathType != pathTypePrefix {
+			return fmt.Errorf("%s can't be used with the %s annotation, use %s instead", rewritesAnnotation, pathRegexAnnotation, rewriteTargetAnnotation)
+		}
+		if loc.GRPC || loc.FastCGI {
+			return fmt.Errorf("%s can't be used with gRPC or FastCGI services, use %s instead", rewritesAnnotation, rewriteTargetAnnotation)
+		}
+		target = rewrite
+	case pathType == pathTypePrefix && captureRegexp.MatchString(target):
+		return fmt.Errorf("rewrite target %q refers to a capture, which requires the %s annotation", target, pathRegexAnnotation)
+	}
+
+	targetPath, query := target, ""
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		targetPath, query = target[:i], target[i:]
+	}
+
+	var original, rewritten string
+	switch pathType {
+	case pathTypeCaseSensitive:
+		loc.RewriteRegex = "^" + path
+		loc.RewriteTarget = target
+		original, rewritten = literalPrefix(path, pathType), literalPrefix(targetPath, pathTypePrefix)
+	case pathTypeCaseInsensitive:
+		loc.RewriteRegex = "(?i)^" + path
+		loc.RewriteTarget = target
+		original, rewritten = literalPrefix(path, pathType), literalPrefix(targetPath, pathTypePrefix)
+	case pathTypeExact:
+		loc.RewriteRegex = "^" + regexp.QuoteMeta(path) + "$"
+		loc.RewriteTarget = target
+		original, rewritten = literalPrefix(path, pathType), literalPrefix(targetPath, pathTypePrefix)
+	default:
+		// the prefixes are compared with a trailing slash, so that /tea/x is rewritten to /x and not //x for the target /
+		prefix := strings.TrimSuffix(path, "/")
+		targetPath = strings.TrimSuffix(targetPath, "/") + "/"
+		loc.RewriteRegex = "^" + regexp.QuoteMeta(prefix) + "/?(.*)$"
+		loc.RewriteTarget = targetPath + "$1" + query
+		original, rewritten = literalPrefix(prefix+"/", pathType), literalPrefix(targetPath, pathTypePrefix)
+	}
+
+	// a prefix can only be mapped back to one that ends with a slash as well
+	if original == rewritten || strings.HasSuffix(original, "/") != strings.HasSuffix(rewritten, "/") {
+		return nil
+	}
+	loc.ProxyRedirectFrom = rewritten
+	loc.ProxyRedirectTo = original
+	return nil
+}
+
+// literalPrefix returns the part of the path before the first regex metacharacter
+// or, for a rewrite target, before the first capture
+func literalPrefix(path string, pathType string) string {
+	stop := "$"
+	if pathType == pathTypeCaseSensitive || pathType == pathTypeCaseInsensitive {
+		stop = `.^$*+?()[]{}|\`
+	}
+	if i := strings.IndexAny(path, stop); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
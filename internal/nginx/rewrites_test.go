@@ -0,0 +1,214 @@
+package nginx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetLocationRewrite(t *testing.T) {
+	tests := []struct {
+		msg      string
+		path     string
+		pathType string
+		rewrite  string
+		target   string
+		expected Location
+	}{
+		{
+			msg:      "no rewrite",
+			path:     "/coffee",
+			pathType: pathTypePrefix,
+			expected: Location{},
+		},
+		{
+			msg:      "rewrite of a prefix",
+			path:     "/coffee",
+			pathType: pathTypePrefix,
+			rewrite:  "/beans",
+			expected: Location{
+				RewriteRegex:      `^/coffee/?(.*)$`,
+				RewriteTarget:     "/beans/$1",
+				ProxyRedirectFrom: "/beans/",
+				ProxyRedirectTo:   "/coffee/",
+			},
+		},
+		{
+			msg:      "rewrite of a prefix to the root",
+			path:     "/tea/",
+			pathType: pathTypePrefix,
+			rewrite:  "/",
+			expected: Location{
+				RewriteRegex:      `^/tea/?(.*)$`,
+				RewriteTarget:     "/$1",
+				ProxyRedirectFrom: "/",
+				ProxyRedirectTo:   "/tea/",
+			},
+		},
+		{
+			msg:      "rewrite with a query string",
+			path:     "/coffee",
+			pathType: pathTypePrefix,
+			rewrite:  "/beans/?roast=dark",
+			expected: Location{
+				RewriteRegex:      `^/coffee/?(.*)$`,
+				RewriteTarget:     "/beans/$1?roast=dark",
+				ProxyRedirectFrom: "/beans/",
+				ProxyRedirectTo:   "/coffee/",
+			},
+		},
+		{
+			msg:      "rewrite target of a prefix",
+			path:     "/tea",
+			pathType: pathTypePrefix,
+			target:   "/",
+			expected: Location{
+				RewriteRegex:      `^/tea/?(.*)$`,
+				RewriteTarget:     "/$1",
+				ProxyRedirectFrom: "/",
+				ProxyRedirectTo:   "/tea/",
+			},
+		},
+		{
+			msg:      "rewrite target of a prefix with regex metacharacters",
+			path:     "/v1.0",
+			pathType: pathTypePrefix,
+			target:   "/api",
+			expected: Location{
+				RewriteRegex:      `^/v1\.0/?(.*)$`,
+				RewriteTarget:     "/api/$1",
+				ProxyRedirectFrom: "/api/",
+				ProxyRedirectTo:   "/v1.0/",
+			},
+		},
+		{
+			msg:      "rewrite target with the captures of a case sensitive regex",
+			path:     "/tea/(green|black)/(.*)",
+			pathType: pathTypeCaseSensitive,
+			target:   "/$1/$2",
+			expected: Location{
+				RewriteRegex:      "^/tea/(green|black)/(.*)",
+				RewriteTarget:     "/$1/$2",
+				ProxyRedirectFrom: "/",
+				ProxyRedirectTo:   "/tea/",
+			},
+		},
+		{
+			msg:      "rewrite target of a case insensitive regex",
+			path:     "/Tea/(.*)",
+			pathType: pathTypeCaseInsensitive,
+			target:   "/drinks/$1",
+			expected: Location{
+				RewriteRegex:      "(?i)^/Tea/(.*)",
+				RewriteTarget:     "/drinks/$1",
+				ProxyRedirectFrom: "/drinks/",
+				ProxyRedirectTo:   "/Tea/",
+			},
+		},
+		{
+			msg:      "rewrite target of a regex whose prefixes can't be mapped back",
+			path:     "/tea/(.*)",
+			pathType: pathTypeCaseSensitive,
+			target:   "/drinks$1",
+			expected: Location{
+				RewriteRegex:  "^/tea/(.*)",
+				RewriteTarget: "/drinks$1",
+			},
+		},
+		{
+			msg:      "rewrite target of an exact path",
+			path:     "/menu.html",
+			pathType: pathTypeExact,
+			target:   "/index.html",
+			expected: Location{
+				RewriteRegex:      `^/menu\.html$`,
+				RewriteTarget:     "/index.html",
+				ProxyRedirectFrom: "/index.html",
+				ProxyRedirectTo:   "/menu.html",
+			},
+		},
+		{
+			msg:      "rewrite target to the same prefix",
+			path:     "/",
+			pathType: pathTypePrefix,
+			target:   "/",
+			expected: Location{
+				RewriteRegex:  `^/?(.*)$`,
+				RewriteTarget: "/$1",
+			},
+		},
+		{
+			msg:      "rewrite target takes precedence over rewrite",
+			path:     "/tea",
+			pathType: pathTypePrefix,
+			rewrite:  "/beans",
+			target:   "/",
+			expected: Location{
+				RewriteRegex:      `^/tea/?(.*)$`,
+				RewriteTarget:     "/$1",
+				ProxyRedirectFrom: "/",
+				ProxyRedirectTo:   "/tea/",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var loc Location
+		if err := setLocationRewrite(&loc, test.path, test.pathType, test.rewrite, test.target); err != nil {
+			t.Errorf("setLocationRewrite() returned an error for the case of %s: %v", test.msg, err)
+			continue
+		}
+		if !reflect.DeepEqual(loc, test.expected) {
+			t.Errorf("setLocationRewrite() returned %+v for the case of %s, expected %+v", loc, test.msg, test.expected)
+		}
+	}
+}
+
+func TestSetLocationRewriteFails(t *testing.T) {
+	tests := []struct {
+		msg      string
+		loc      Location
+		path     string
+		pathType string
+		rewrite  string
+		target   string
+	}{
+		{
+			msg:      "capture in the rewrite target of a prefix",
+			path:     "/tea",
+			pathType: pathTypePrefix,
+			target:   "/$1",
+		},
+		{
+			msg:      "rewrite of a regex",
+			path:     "/tea/(.*)",
+			pathType: pathTypeCaseSensitive,
+			rewrite:  "/beans",
+		},
+		{
+			msg:      "rewrite of an exact path",
+			path:     "/tea",
+			pathType: pathTypeExact,
+			rewrite:  "/beans",
+		},
+		{
+			msg:      "rewrite of a gRPC location",
+			loc:      Location{GRPC: true},
+			path:     "/tea",
+			pathType: pathTypePrefix,
+			rewrite:  "/beans",
+		},
+		{
+			msg:      "rewrite of a FastCGI location",
+			loc:      Location{FastCGI: true},
+			path:     "/tea",
+			pathType: pathTypePrefix,
+			rewrite:  "/beans",
+		},
+	}
+
+	for _, test := range tests {
+		if err := setLocationRewrite(&test.loc, test.path, test.pathType, test.rewrite, test.target); err == nil {
+			t.Errorf("setLocationRewrite() returned no error for the case of %s", test.msg)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package nginx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// The configuration files are written to a staging directory, validated with nginx -t and only then
+// copied to the NGINX configuration directory, which thus always holds the last valid configuration.
+const (
+	stagingDir     = "staging"
+	confdDir       = "conf.d"
+	mainConfigFile = "nginx.conf"
+)
+
+// contentFileRegexp matches the pem files and the error pages directories named after their content
+var contentFileRegexp = regexp.MustCompile(`-[0-9a-f]{16}(\.tmp)?$`)
+
+// configErrorFileRegexp matches the file of an error of nginx -t, e.g.
+// `nginx: [emerg] unknown directive "foo" in /etc/nginx/staging/conf.d/default-cafe.conf:12`
+var configErrorFileRegexp = regexp.MustCompile(` in (/\S+):\d+`)
+
+// getContentHash returns a short hash of the content of the files the configuration of an Ingress refers to,
+// like the pem files of its TLS secrets, which are named after it. When their content changes, the configuration
+// refers to new files, so it's validated and NGINX is reloaded, while the applied configuration still refers
+// to the previous files until then. The files no longer referred to are deleted by removeUnusedFiles.
+func getContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// removeUnusedFiles deletes the pem files and the error pages directories that neither the applied
+// nor the staged configuration refers to anymore
+func (nginx *Controller) removeUnusedFiles() {
+	var used []byte
+	for _, file := range nginx.getConfigFiles() {
+		for _, dir := range []string{nginx.nginxConfPath, nginx.nginxStagingPath} {
+			if content, err := ioutil.ReadFile(path.Join(dir, file)); err == nil {
+				used = append(used, content...)
+			}
+		}
+	}
+
+	for _, dir := range []string{nginx.nginxSecretsPath, nginx.nginxErrorPagesPath} {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := path.Join(dir, entry.Name())
+			if !contentFileRegexp.MatchString(entry.Name()) || bytes.Contains(used, []byte(name)) {
+				continue
+			}
+			glog.V(3).Infof("deleting %v", name)
+			if err := os.RemoveAll(name); err != nil {
+				glog.Warningf("Failed to delete %v: %v", name, err)
+			}
+		}
+	}
+}
+
+// initStaging creates the staging directory with the applied configuration files. The other files
+// of the NGINX configuration directory are linked, so the relative includes work from both directories.
+func (nginx *Controller) initStaging() {
+	if err := os.RemoveAll(nginx.nginxStagingPath); err != nil {
+		glog.Fatalf("Failed to delete %v: %v", nginx.nginxStagingPath, err)
+	}
+	if err := os.MkdirAll(path.Join(nginx.nginxStagingPath, confdDir), 0755); err != nil {
+		glog.Fatalf("Failed to create %v: %v", nginx.nginxStagingPath, err)
+	}
+
+	entries, err := ioutil.ReadDir(nginx.nginxConfPath)
+	if err != nil {
+		glog.Fatalf("Failed to read %v: %v", nginx.nginxConfPath, err)
+	}
+	for _, entry := range entries {
+		switch entry.Name() {
+		case stagingDir, confdDir, mainConfigFile:
+			continue
+		}
+		if err := os.Symlink(path.Join(nginx.nginxConfPath, entry.Name()), path.Join(nginx.nginxStagingPath, entry.Name())); err != nil {
+			glog.Fatalf("Failed to link %v to the staging directory: %v", entry.Name(), err)
+		}
+	}
+
+	for _, file := range nginx.getConfigFiles() {
+		nginx.restoreStagedFile(file)
+	}
+}
+
+// getConfigFiles returns the configuration files, relative to the configuration directory,
+// that are either applied or staged
+func (nginx *Controller) getConfigFiles() []string {
+	files := map[string]bool{mainConfigFile: true}
+	for _, dir := range []string{nginx.nginxConfPath, nginx.nginxStagingPath} {
+		entries, err := ioutil.ReadDir(path.Join(dir, confdDir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".conf") {
+				files[path.Join(confdDir, entry.Name())] = true
+			}
+		}
+	}
+
+	var result []string
+	for file := range files {
+		result = append(result, file)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// getStagedChanges returns the configuration files whose staged version differs from the applied one
+func (nginx *Controller) getStagedChanges() []string {
+	var changes []string
+	for _, file := range nginx.getConfigFiles() {
+		staged, stagedErr := ioutil.ReadFile(path.Join(nginx.nginxStagingPath, file))
+		applied, appliedErr := ioutil.ReadFile(path.Join(nginx.nginxConfPath, file))
+		if os.IsNotExist(stagedErr) != os.IsNotExist(appliedErr) || !bytes.Equal(staged, applied) {
+			changes = append(changes, file)
+		}
+	}
+	return changes
+}
+
+// restoreStagedFile restores the staged version of the file to the applied one
+func (nginx *Controller) restoreStagedFile(file string) {
+	applied, err := ioutil.ReadFile(path.Join(nginx.nginxConfPath, file))
+	if err != nil && !os.IsNotExist(err) {
+		glog.Fatalf("Failed to read %v: %v", file, err)
+	}
+	nginx.writeStagedFile(file, applied, err == nil)
+}
+
+// writeStagedFile writes the staged version of the file, or deletes it if it doesn't exist
+func (nginx *Controller) writeStagedFile(file string, content []byte, exists bool) {
+	staged := path.Join(nginx.nginxStagingPath, file)
+	if !exists {
+		if err := os.Remove(staged); err != nil && !os.IsNotExist(err) {
+			glog.Warningf("Failed to delete %v: %v", staged, err)
+		}
+		return
+	}
+	if err := ioutil.WriteFile(staged, content, 0644); err != nil {
+		glog.Fatalf("Failed to write to %v: %v", staged, err)
+	}
+}
+
+// applyFile copies the staged version of the file to the configuration directory.
+// The file is renamed into place, so NGINX never reads a partial file.
+func (nginx *Controller) applyFile(file string) {
+	applied := path.Join(nginx.nginxConfPath, file)
+	staged, err := ioutil.ReadFile(path.Join(nginx.nginxStagingPath, file))
+	if os.IsNotExist(err) {
+		if err := os.Remove(applied); err != nil && !os.IsNotExist(err) {
+			glog.Warningf("Failed to delete %v: %v", applied, err)
+		}
+		return
+	}
+	if err != nil {
+		glog.Fatalf("Failed to read the staged %v: %v", file, err)
+	}
+
+	tmp := path.Join(path.Dir(applied), "."+path.Base(applied)+".tmp")
+	if err := ioutil.WriteFile(tmp, staged, 0644); err != nil {
+		glog.Fatalf("Failed to write to %v: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, applied); err != nil {
+		glog.Fatalf("Failed to rename %v to %v: %v", tmp, applied, err)
+	}
+}
+
+// testStagedConfig runs nginx -t against the staged configuration.
+// The paths of the error are the ones of the configuration directory.
+func (nginx *Controller) testStagedConfig() (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(nginx.nginxBinaryPath, "-t", "-q", "-c", path.Join(nginx.nginxStagingPath, mainConfigFile))
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stderr.String())
+		if output == "" {
+			return "", fmt.Errorf("nginx -t failed: %v", err)
+		}
+
+		file := ""
+		if match := configErrorFileRegexp.FindStringSubmatch(output); match != nil {
+			if rel := strings.TrimPrefix(match[1], nginx.nginxStagingPath+"/"); rel != match[1] {
+				file = rel
+			}
+		}
+		return file, fmt.Errorf("%v", strings.Replace(output, nginx.nginxStagingPath, nginx.nginxConfPath, -1))
+	}
+	return "", nil
+}
+
+// Apply validates the staged configuration with nginx -t and applies the changed files.
+// The files NGINX rejects are restored to their applied version while the other changes are applied:
+// the errors of the Ingresses are returned by Ingress name, and the error of the main configuration file
+// is returned as error. It returns the applied files. The pem files and error pages
+// that neither the applied nor the staged configuration refers to are deleted.
+func (nginx *Controller) Apply() ([]string, map[string]error, error) {
+	rejected := make(map[string]error)
+	if nginx.local {
+		return nil, rejected, nil
+	}
+	defer nginx.removeUnusedFiles()
+
+	var mainErr error
+	var changes []string
+	for {
+		changes = nginx.getStagedChanges()
+		if len(changes) == 0 {
+			return nil, rejected, mainErr
+		}
+
+		file, err := nginx.testStagedConfig()
+		if err == nil {
+			break
+		}
+
+		if !containsString(changes, file) {
+			// the error is in a file that didn't change or in no file, e.g. for an invalid certificate
+			if err := nginx.findRejectedChanges(changes, rejected, &mainErr); err != nil {
+				return nil, rejected, err
+			}
+			continue
+		}
+		nginx.rejectStagedFile(file, err, rejected, &mainErr)
+	}
+
+	for _, change := range changes {
+		nginx.applyFile(change)
+	}
+	return changes, rejected, mainErr
+}
+
+// findRejectedChanges finds the changes NGINX rejects by testing them one at a time on top of the applied
+// configuration, and restores them. If NGINX rejects the applied configuration itself, the changes stay
+// staged and an error is returned.
+func (nginx *Controller) findRejectedChanges(changes []string, rejected map[string]error, mainErr *error) error {
+	staged := make(map[string][]byte)
+	for _, change := range changes {
+		content, err := ioutil.ReadFile(path.Join(nginx.nginxStagingPath, change))
+		if err != nil && !os.IsNotExist(err) {
+			glog.Fatalf("Failed to read the staged %v: %v", change, err)
+		}
+		if err == nil {
+			staged[change] = content
+		}
+		nginx.restoreStagedFile(change)
+	}
+
+	if _, err := nginx.testStagedConfig(); err != nil {
+		for _, change := range changes {
+			content, exists := staged[change]
+			nginx.writeStagedFile(change, content, exists)
+		}
+		return fmt.Errorf("invalid configuration, NGINX rejects the applied one: %v", err)
+	}
+
+	for _, change := range changes {
+		content, exists := staged[change]
+		nginx.writeStagedFile(change, content, exists)
+		if _, err := nginx.testStagedConfig(); err != nil {
+			nginx.rejectStagedFile(change, err, rejected, mainErr)
+		}
+	}
+	return nil
+}
+
+// rejectStagedFile restores the file NGINX rejected to its applied version and records the error,
+// by Ingress name for the configuration of an Ingress
+func (nginx *Controller) rejectStagedFile(file string, err error, rejected map[string]error, mainErr *error) {
+	nginx.restoreStagedFile(file)
+	if file == mainConfigFile {
+		*mainErr = fmt.Errorf("invalid main configuration, kept the last valid one: %v", err)
+		return
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(file, confdDir+"/"), ".conf")
+	log.Printf("NGINX rejected the configuration of %v, restored its last valid one: %v", name, err)
+	rejected[name] = err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
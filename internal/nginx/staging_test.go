@@ -0,0 +1,330 @@
+package nginx
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeNginx is an nginx binary whose nginx -t rejects the configuration files that contain "invalid", naming
+// the file in the error, and the certificates that contain "invalid", without naming a file like NGINX does.
+// nginx -s reload fails while the file reload-fails exists next to the binary.
+const fakeNginx = `#!/bin/sh
+if [ "$1" = -s ]; then
+	[ ! -f "$(dirname "$0")/reload-fails" ]
+	exit
+fi
+conf="$4"
+for f in "$conf" "$(dirname "$conf")"/conf.d/*.conf; do
+	[ -f "$f" ] || continue
+	if grep -q invalid "$f"; then
+		echo "nginx: [emerg] unknown directive \"invalid\" in $f:1" >&2
+		exit 1
+	fi
+	for cert in $(sed -n 's/^ssl_certificate \(.*\);$/\1/p' "$f"); do
+		if grep -q invalid "$cert"; then
+			echo "nginx: [emerg] cannot load certificate \"$cert\": PEM_read_bio_X509_AUX() failed" >&2
+			exit 1
+		fi
+	done
+done
+`
+
+// newTestController creates an NGINX controller for a configuration directory with the applied files
+// and the fake nginx binary. The directory must be deleted by the caller.
+func newTestController(t *testing.T, applied map[string]string) (*Controller, string) {
+	dir, err := ioutil.TempDir("", "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"conf.d", "secrets", "bin"} {
+		if err := os.MkdirAll(path.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, content := range applied {
+		if err := ioutil.WriteFile(path.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	binary := path.Join(dir, "bin", "nginx")
+	if err := ioutil.WriteFile(binary, []byte(fakeNginx), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewNginxController(dir, binary, false), dir
+}
+
+// readConfigFiles returns the content of the main configuration file and the files of conf.d in the directory
+func readConfigFiles(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	names := []string{mainConfigFile}
+	entries, err := ioutil.ReadDir(path.Join(dir, confdDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".conf") {
+			names = append(names, path.Join(confdDir, entry.Name()))
+		}
+	}
+	for _, name := range names {
+		content, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(content)
+	}
+	return files
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		msg     string
+		applied map[string]string
+		// stage writes the changes to the staging directory
+		stage            func(nginx *Controller)
+		expectedApplied  []string
+		expectedFiles    map[string]string
+		expectedRejected []string
+		expectedMainErr  bool
+		expectedErr      bool
+		expectedStaged   []string
+	}{
+		{
+			msg:     "no change",
+			applied: map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "a"},
+			stage:   func(nginx *Controller) {},
+			expectedFiles: map[string]string{
+				"nginx.conf":            "main",
+				"conf.d/default-a.conf": "a",
+			},
+		},
+		{
+			msg:     "valid changes",
+			applied: map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "a", "conf.d/default-b.conf": "b"},
+			stage: func(nginx *Controller) {
+				nginx.UpdateMainConfigFile([]byte("main 2"))
+				nginx.UpdateIngressConfigFile("default-a", []byte("a 2"))
+				nginx.UpdateIngressConfigFile("default-c", []byte("c"))
+				nginx.DeleteIngress("default-b")
+			},
+			expectedApplied: []string{"conf.d/default-a.conf", "conf.d/default-b.conf", "conf.d/default-c.conf", "nginx.conf"},
+			expectedFiles: map[string]string{
+				"nginx.conf":            "main 2",
+				"conf.d/default-a.conf": "a 2",
+				"conf.d/default-c.conf": "c",
+			},
+		},
+		{
+			msg:     "partial rejection",
+			applied: map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "a"},
+			stage: func(nginx *Controller) {
+				nginx.UpdateIngressConfigFile("default-a", []byte("invalid a"))
+				nginx.UpdateIngressConfigFile("default-b", []byte("b"))
+				nginx.UpdateIngressConfigFile("default-c", []byte("invalid c"))
+			},
+			expectedApplied: []string{"conf.d/default-b.conf"},
+			expectedFiles: map[string]string{
+				"nginx.conf":            "main",
+				"conf.d/default-a.conf": "a",
+				"conf.d/default-b.conf": "b",
+			},
+			expectedRejected: []string{"default-a", "default-c"},
+		},
+		{
+			msg:     "main configuration rejection",
+			applied: map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "a"},
+			stage: func(nginx *Controller) {
+				nginx.UpdateMainConfigFile([]byte("invalid main"))
+				nginx.UpdateIngressConfigFile("default-a", []byte("a 2"))
+			},
+			expectedApplied: []string{"conf.d/default-a.conf"},
+			expectedFiles: map[string]string{
+				"nginx.conf":            "main",
+				"conf.d/default-a.conf": "a 2",
+			},
+			expectedMainErr: true,
+		},
+		{
+			msg:     "rejection of all the changes",
+			applied: map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "a"},
+			stage: func(nginx *Controller) {
+				nginx.UpdateMainConfigFile([]byte("invalid main"))
+				nginx.UpdateIngressConfigFile("default-a", []byte("invalid a"))
+			},
+			expectedFiles: map[string]string{
+				"nginx.conf":            "main",
+				"conf.d/default-a.conf": "a",
+			},
+			expectedRejected: []string{"default-a"},
+			expectedMainErr:  true,
+		},
+		{
+			msg:     "rejection of a certificate, with an error that names no file",
+			applied: map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "a"},
+			stage: func(nginx *Controller) {
+				pem := nginx.AddOrUpdateCertAndKey("default-secret", "invalid certificate", "key")
+				nginx.UpdateIngressConfigFile("default-a", []byte("ssl_certificate "+pem+";"))
+				nginx.UpdateIngressConfigFile("default-b", []byte("b"))
+				nginx.UpdateMainConfigFile([]byte("main 2"))
+			},
+			expectedApplied: []string{"conf.d/default-b.conf", "nginx.conf"},
+			expectedFiles: map[string]string{
+				"nginx.conf":            "main 2",
+				"conf.d/default-a.conf": "a",
+				"conf.d/default-b.conf": "b",
+			},
+			expectedRejected: []string{"default-a"},
+		},
+		{
+			msg:     "invalid applied configuration",
+			applied: map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "invalid a"},
+			stage: func(nginx *Controller) {
+				nginx.UpdateIngressConfigFile("default-b", []byte("b"))
+			},
+			expectedFiles: map[string]string{
+				"nginx.conf":            "main",
+				"conf.d/default-a.conf": "invalid a",
+			},
+			expectedErr:    true,
+			expectedStaged: []string{"conf.d/default-b.conf"},
+		},
+	}
+
+	for _, test := range tests {
+		nginx, dir := newTestController(t, test.applied)
+		defer os.RemoveAll(dir)
+
+		test.stage(nginx)
+		applied, rejected, err := nginx.Apply()
+
+		if !reflect.DeepEqual(applied, test.expectedApplied) {
+			t.Errorf("Apply() applied %v for the case of %s, expected %v", applied, test.msg, test.expectedApplied)
+		}
+
+		var rejectedNames []string
+		for name := range rejected {
+			rejectedNames = append(rejectedNames, name)
+		}
+		sort.Strings(rejectedNames)
+		if !reflect.DeepEqual(rejectedNames, test.expectedRejected) {
+			t.Errorf("Apply() rejected %v for the case of %s, expected %v", rejected, test.msg, test.expectedRejected)
+		}
+
+		if expectedErr := test.expectedMainErr || test.expectedErr; (err != nil) != expectedErr {
+			t.Errorf("Apply() returned the error %v for the case of %s, expected an error: %v", err, test.msg, expectedErr)
+		}
+
+		if files := readConfigFiles(t, dir); !reflect.DeepEqual(files, test.expectedFiles) {
+			t.Errorf("Apply() left the files %v for the case of %s, expected %v", files, test.msg, test.expectedFiles)
+		}
+
+		if staged := nginx.getStagedChanges(); !reflect.DeepEqual(staged, test.expectedStaged) {
+			t.Errorf("Apply() left the staged changes %v for the case of %s, expected %v", staged, test.msg, test.expectedStaged)
+		}
+	}
+}
+
+func TestApplyRemovesUnusedFiles(t *testing.T) {
+	nginx, dir := newTestController(t, map[string]string{"nginx.conf": "main"})
+	defer os.RemoveAll(dir)
+
+	// a file of the image that isn't named after its content
+	defaultPem := path.Join(dir, "secrets", "default")
+	if err := ioutil.WriteFile(defaultPem, []byte("default"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pem := nginx.AddOrUpdateCertAndKey("default-secret", "certificate", "key")
+	pages := nginx.UpdateErrorPagesFiles("default-a", []ErrorPage{{Code: 404, Body: []byte("not found")}})
+	nginx.UpdateIngressConfigFile("default-a", []byte("ssl_certificate "+pem+";\nalias "+pages+"/;"))
+	if _, _, err := nginx.Apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	newPem := nginx.AddOrUpdateCertAndKey("default-secret", "new certificate", "key")
+	if newPem == pem {
+		t.Fatalf("AddOrUpdateCertAndKey() returned the same file %v for a different certificate", pem)
+	}
+	invalidPem := nginx.AddOrUpdateCertAndKey("default-other", "invalid certificate", "key")
+	nginx.UpdateIngressConfigFile("default-a", []byte("ssl_certificate "+newPem+";"))
+	nginx.UpdateIngressConfigFile("default-b", []byte("ssl_certificate "+invalidPem+";"))
+
+	applied, rejected, err := nginx.Apply()
+	if err != nil || len(applied) != 1 || len(rejected) != 1 {
+		t.Fatalf("Apply() returned %v, %v, %v, expected the change of default-a and the rejection of default-b", applied, rejected, err)
+	}
+
+	tests := []struct {
+		file   string
+		exists bool
+	}{
+		{defaultPem, true},
+		{pem, false},
+		{newPem, true},
+		{invalidPem, false},
+		{pages, false},
+	}
+	for _, test := range tests {
+		if _, err := os.Stat(test.file); os.IsNotExist(err) == test.exists {
+			t.Errorf("Apply() left %v existing: %v, expected %v", test.file, !os.IsNotExist(err), test.exists)
+		}
+	}
+}
+
+func TestApplyKeepsFilesOfStagedChanges(t *testing.T) {
+	nginx, dir := newTestController(t, map[string]string{"nginx.conf": "main", "conf.d/default-a.conf": "invalid a"})
+	defer os.RemoveAll(dir)
+
+	pem := nginx.AddOrUpdateCertAndKey("default-secret", "certificate", "key")
+	nginx.UpdateIngressConfigFile("default-b", []byte("ssl_certificate "+pem+";"))
+
+	// NGINX rejects the applied configuration, so the change of default-b stays staged with its pem file
+	if _, _, err := nginx.Apply(); err == nil {
+		t.Fatal("Apply() returned no error for an invalid applied configuration")
+	}
+	if _, err := os.Stat(pem); err != nil {
+		t.Fatalf("Apply() deleted %v of the staged configuration: %v", pem, err)
+	}
+
+	nginx.UpdateIngressConfigFile("default-a", []byte("a"))
+	applied, _, err := nginx.Apply()
+	if err != nil || !reflect.DeepEqual(applied, []string{"conf.d/default-a.conf", "conf.d/default-b.conf"}) {
+		t.Errorf("Apply() returned %v, %v, expected the changes of default-a and default-b", applied, err)
+	}
+}
+
+func TestReloadRetriesFailedReload(t *testing.T) {
+	nginx, dir := newTestController(t, map[string]string{"nginx.conf": "main"})
+	defer os.RemoveAll(dir)
+
+	reloadFails := path.Join(dir, "bin", "reload-fails")
+	if err := ioutil.WriteFile(reloadFails, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nginx.UpdateIngressConfigFile("default-a", []byte("a"))
+	if reloaded, _, err := nginx.Reload(); !reloaded || err == nil || !nginx.ReloadPending() {
+		t.Fatalf("Reload() returned %v, %v with a failing reload, expected a pending reload", reloaded, err)
+	}
+
+	// the change is applied, so only the pending reload is left
+	if reloaded, _, err := nginx.Reload(); !reloaded || err == nil || !nginx.ReloadPending() {
+		t.Fatalf("Reload() returned %v, %v with a failing reload, expected a pending reload", reloaded, err)
+	}
+
+	if err := os.Remove(reloadFails); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, _, err := nginx.Reload(); !reloaded || err != nil || nginx.ReloadPending() {
+		t.Errorf("Reload() returned %v, %v, expected the pending reload", reloaded, err)
+	}
+	if reloaded, _, err := nginx.Reload(); reloaded || err != nil {
+		t.Errorf("Reload() returned %v, %v without any change, expected no reload", reloaded, err)
+	}
+}
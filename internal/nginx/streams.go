@@ -0,0 +1,193 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Protocols of the stream services
+const (
+	StreamProtocolTCP = "TCP"
+	StreamProtocolUDP = "UDP"
+)
+
+// StreamService is an entry of the TCP or UDP services ConfigMap:
+// the external port mapped to namespace/service:port, with an optional PROXY protocol
+type StreamService struct {
+	Port          int
+	Protocol      string
+	Namespace     string
+	ServiceName   string
+	ServicePort   intstr.IntOrString
+	ProxyProtocol bool
+}
+
+// StreamServiceEx holds a stream service and the endpoints of its service
+type StreamServiceEx struct {
+	StreamService
+	Endpoints []string
+}
+
+// StreamServer describes a server of the NGINX stream block
+type StreamServer struct {
+	Port          int
+	UDP           bool
+	ProxyProtocol bool
+	Upstream      Upstream
+}
+
+// ParseStreamServices parses the entries of the TCP or UDP services ConfigMap,
+// e.g. `9000: "default/nsqd:4150:PROXY"`. Invalid entries are logged and ignored.
+func ParseStreamServices(cfgm *api_v1.ConfigMap, protocol string) []StreamService {
+	var services []StreamService
+
+	for key, value := range cfgm.Data {
+		svc, err := parseStreamService(key, value, protocol)
+		if err != nil {
+			glog.Errorf("Configmap %s/%s: Invalid %v service %v: %v, ignoring", cfgm.GetNamespace(), cfgm.GetName(), protocol, key, err)
+			continue
+		}
+		services = append(services, svc)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Port < services[j].Port
+	})
+	return services
+}
+
+func parseStreamService(key string, value string, protocol string) (StreamService, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(key))
+	if err != nil || port < 1 || port > 65535 {
+		return StreamService{}, fmt.Errorf("%q is not a valid port", key)
+	}
+
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return StreamService{}, fmt.Errorf("%q must follow the format <namespace>/<service>:<port>[:PROXY]", value)
+	}
+
+	nsName := strings.Split(parts[0], "/")
+	if len(nsName) != 2 || !serviceNameRegexp.MatchString(nsName[0]) || !serviceNameRegexp.MatchString(nsName[1]) {
+		return StreamService{}, fmt.Errorf("%q is not a valid <namespace>/<service>", parts[0])
+	}
+	if !serviceNameRegexp.MatchString(parts[1]) {
+		return StreamService{}, fmt.Errorf("%q is not a valid port", parts[1])
+	}
+
+	svc := StreamService{
+		Port:        port,
+		Protocol:    protocol,
+		Namespace:   nsName[0],
+		ServiceName: nsName[1],
+		ServicePort: intstr.Parse(parts[1]),
+	}
+
+	if len(parts) == 3 {
+		if parts[2] != "PROXY" {
+			return StreamService{}, fmt.Errorf("%q is not a valid option, must be PROXY", parts[2])
+		}
+		svc.ProxyProtocol = true
+	}
+
+	return svc, nil
+}
+
+// generateStreamServers generates the servers and the upstreams of the stream services.
+// Services on the HTTP or HTTPS ports, including the ones of nginx.org/listen-ports and
+// nginx.org/listen-ports-ssl, would fail to bind, so they are logged and ignored.
+func (cnf *NgxConfig) generateStreamServers(streams []StreamServiceEx) []StreamServer {
+	var servers []StreamServer
+
+	httpPorts := map[int]bool{int(cnf.config.HTTPPort): true, int(cnf.config.HTTPSPort): true}
+	for _, port := range append(cnf.getExtraListenPorts(), cnf.getSSLListenPorts()...) {
+		httpPorts[port] = true
+	}
+
+	for _, stream := range streams {
+		if httpPorts[stream.Port] {
+			glog.Errorf("%v service %v/%v: port %v is used by the HTTP servers, ignoring", stream.Protocol, stream.Namespace, stream.ServiceName, stream.Port)
+			continue
+		}
+
+		name := fmt.Sprintf("stream-%v-%v-%v-%v-%v", strings.ToLower(stream.Protocol), stream.Port, stream.Namespace, stream.ServiceName, stream.ServicePort.String())
+		upstream := Upstream{
+			Name:     name,
+			LBMethod: getStreamLBMethod(cnf.config.LBMethod),
+		}
+		for _, endp := range stream.Endpoints {
+			addressport := strings.Split(endp, ":")
+			upstream.UpstreamServers = append(upstream.UpstreamServers, UpstreamServer{
+				Address:     addressport[0],
+				Port:        addressport[1],
+				MaxFails:    cnf.config.MaxFails,
+				FailTimeout: cnf.config.FailTimeout,
+			})
+		}
+		upstream.NoEndpoints = len(upstream.UpstreamServers) == 0
+
+		servers = append(servers, StreamServer{
+			Port:          stream.Port,
+			UDP:           stream.Protocol == StreamProtocolUDP,
+			ProxyProtocol: stream.ProxyProtocol,
+			Upstream:      upstream,
+		})
+	}
+
+	return servers
+}
+
+// streamHashVariables are the variables of the stream module a hash key of the stream upstreams can use
+var streamHashVariables = map[string]bool{
+	"remote_addr":         true,
+	"binary_remote_addr":  true,
+	"remote_port":         true,
+	"server_addr":         true,
+	"server_port":         true,
+	"proxy_protocol_addr": true,
+	"proxy_protocol_port": true,
+	"protocol":            true,
+}
+
+var variableRegexp = regexp.MustCompile(`\$(\{\w+\}|\w+)`)
+
+// getStreamLBMethod returns the load balancing method of the stream upstreams. ip_hash is only available
+// in the http module, and so are the HTTP variables like $request_uri, so a hash on them falls back to round-robin.
+func getStreamLBMethod(method string) string {
+	if method == "ip_hash" {
+		return "hash $remote_addr"
+	}
+
+	fields := strings.Fields(method)
+	if len(fields) > 1 && fields[0] == "hash" {
+		for _, match := range variableRegexp.FindAllStringSubmatch(fields[1], -1) {
+			if name := strings.Trim(match[1], "{}"); !streamHashVariables[name] {
+				glog.Warningf("The load balancing method %q uses the variable $%v, which isn't available to the TCP and UDP services, using round-robin for them", method, name)
+				return ""
+			}
+		}
+	}
+	return method
+}
+
+// UpdateStreams regenerates the stream block of the main NGINX configuration with the stream services.
+// NGINX is reloaded by the reload scheduler.
+func (cnf *NgxConfig) UpdateStreams(streams []StreamServiceEx) error {
+	cnf.lock.Lock()
+	defer cnf.lock.Unlock()
+
+	cnf.streams = streams
+
+	if err := cnf.updateMainConfig(); err != nil {
+		return err
+	}
+	cnf.reloads.markDirty()
+	return nil
+}
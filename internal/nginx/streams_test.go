@@ -0,0 +1,147 @@
+package nginx
+
+import (
+	"reflect"
+	"testing"
+
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestParseStreamService(t *testing.T) {
+	tests := []struct {
+		key      string
+		value    string
+		expected StreamService
+	}{
+		{
+			key:   "9000",
+			value: "default/nsqd:4150",
+			expected: StreamService{
+				Port:        9000,
+				Protocol:    StreamProtocolTCP,
+				Namespace:   "default",
+				ServiceName: "nsqd",
+				ServicePort: intstr.FromInt(4150),
+			},
+		},
+		{
+			key:   " 9001 ",
+			value: " default/postgres:postgres:PROXY ",
+			expected: StreamService{
+				Port:          9001,
+				Protocol:      StreamProtocolTCP,
+				Namespace:     "default",
+				ServiceName:   "postgres",
+				ServicePort:   intstr.FromString("postgres"),
+				ProxyProtocol: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		svc, err := parseStreamService(test.key, test.value, StreamProtocolTCP)
+		if err != nil {
+			t.Errorf("parseStreamService(%q, %q) returned an error: %v", test.key, test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(svc, test.expected) {
+			t.Errorf("parseStreamService(%q, %q) returned %+v, expected %+v", test.key, test.value, svc, test.expected)
+		}
+	}
+}
+
+func TestParseStreamServiceFails(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"dns", "kube-system/kube-dns:53"},
+		{"0", "kube-system/kube-dns:53"},
+		{"65536", "kube-system/kube-dns:53"},
+		{"9000", "nsqd:4150"},
+		{"9000", "default/nsqd"},
+		{"9000", "default/nsqd:4150:PROXY:extra"},
+		{"9000", "default/nsqd:4150:proxy"},
+		{"9000", "default/Nsqd:4150"},
+		{"9000", "default/nsqd/extra:4150"},
+		{"9000", "default/nsqd:tcp_4150"},
+	}
+
+	for _, test := range tests {
+		if svc, err := parseStreamService(test.key, test.value, StreamProtocolTCP); err == nil {
+			t.Errorf("parseStreamService(%q, %q) returned %+v instead of an error", test.key, test.value, svc)
+		}
+	}
+}
+
+func TestParseStreamServices(t *testing.T) {
+	cfgm := &api_v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "udp-services", Namespace: "default"},
+		Data: map[string]string{
+			"5353": "kube-system/kube-dns:53",
+			"53":   "kube-system/kube-dns:dns",
+			"dns":  "kube-system/kube-dns:53",
+		},
+	}
+	expected := []StreamService{
+		{Port: 53, Protocol: StreamProtocolUDP, Namespace: "kube-system", ServiceName: "kube-dns", ServicePort: intstr.FromString("dns")},
+		{Port: 5353, Protocol: StreamProtocolUDP, Namespace: "kube-system", ServiceName: "kube-dns", ServicePort: intstr.FromInt(53)},
+	}
+
+	services := ParseStreamServices(cfgm, StreamProtocolUDP)
+	if !reflect.DeepEqual(services, expected) {
+		t.Errorf("ParseStreamServices() returned %+v, expected %+v", services, expected)
+	}
+}
+
+func TestGetStreamLBMethod(t *testing.T) {
+	tests := []struct {
+		method   string
+		expected string
+	}{
+		{"", ""},
+		{"least_conn", "least_conn"},
+		{"random two least_conn", "random two least_conn"},
+		{"ip_hash", "hash $remote_addr"},
+		{"hash $remote_addr", "hash $remote_addr"},
+		{"hash $binary_remote_addr$remote_port consistent", "hash $binary_remote_addr$remote_port consistent"},
+		{"hash ${proxy_protocol_addr}:${server_port}", "hash ${proxy_protocol_addr}:${server_port}"},
+		{"hash $request_uri consistent", ""},
+		{"hash $remote_addr$host", ""},
+		{"hash ${http_x_user}", ""},
+	}
+
+	for _, test := range tests {
+		if result := getStreamLBMethod(test.method); result != test.expected {
+			t.Errorf("getStreamLBMethod(%q) returned %q, expected %q", test.method, result, test.expected)
+		}
+	}
+}
+
+func TestGenerateStreamServersSkipsHTTPPorts(t *testing.T) {
+	cnf := &NgxConfig{
+		config:         NewDefaultConfig(),
+		listenPorts:    map[string][]int{"default-a": {80, 8080}},
+		sslListenPorts: map[string][]int{"default-a": {8443}},
+	}
+	var streams []StreamServiceEx
+	for _, port := range []int{80, 443, 8080, 8443, 9000} {
+		streams = append(streams, StreamServiceEx{StreamService: StreamService{
+			Port:        port,
+			Protocol:    StreamProtocolTCP,
+			Namespace:   "default",
+			ServiceName: "nsqd",
+			ServicePort: intstr.FromInt(4150),
+		}})
+	}
+
+	var ports []int
+	for _, server := range cnf.generateStreamServers(streams) {
+		ports = append(ports, server.Port)
+	}
+	if expected := []int{9000}; !reflect.DeepEqual(ports, expected) {
+		t.Errorf("generateStreamServers() generated servers on the ports %v, expected %v", ports, expected)
+	}
+}
@@ -2,8 +2,8 @@ package nginx
 
 import (
 	"bytes"
-	"html/template"
 	"path"
+	"text/template"
 )
 
 // TemplateExecutor executes NGINX configuration templates
@@ -50,8 +50,7 @@ func (te *TemplateExecutor) ExecuteIngressConfigTemplate(cfg *IngressNginxConfig
 }
 
 // ExecuteMainConfigTemplate generates the content of the main NGINX configuration file
-func (te *TemplateExecutor) ExecuteMainConfigTemplate() ([]byte, error) {
-	cfg := &MainConfig{}
+func (te *TemplateExecutor) ExecuteMainConfigTemplate(cfg *MainConfig) ([]byte, error) {
 	var configBuffer bytes.Buffer
 	err := te.mainTemplate.Execute(&configBuffer, cfg)
 
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
@@ -20,6 +21,8 @@ type TaskQueue struct {
 	sync func(Task)
 	// workerDone is closed when the worker exits
 	workerDone chan struct{}
+	// started is set once the worker is started
+	started int32
 }
 
 // NewTaskQueue creates a new task queue with the given sync function.
@@ -34,9 +37,21 @@ func NewTaskQueue(syncFn func(Task)) *TaskQueue {
 
 // Run begins running the worker for the given duration
 func (t *TaskQueue) Run(period time.Duration, stopCh <-chan struct{}) {
+	atomic.StoreInt32(&t.started, 1)
 	wait.Until(t.worker, period, stopCh)
 }
 
+// Clear drops the tasks of the queue. It must be called before the worker is started.
+func (t *TaskQueue) Clear() {
+	for t.queue.Len() > 0 {
+		task, quit := t.queue.Get()
+		if quit {
+			return
+		}
+		t.queue.Done(task)
+	}
+}
+
 // Enqueue enqueues ns/name of the given api object in the task queue.
 func (t *TaskQueue) Enqueue(obj interface{}) {
 	key, err := keyFunc(obj)
@@ -85,8 +100,10 @@ func (t *TaskQueue) worker() {
 	}
 }
 
-// Shutdown shuts down the work queue and waits for the worker to ACK
+// Shutdown shuts down the work queue and waits for the worker to ACK, if it was started
 func (t *TaskQueue) Shutdown() {
 	t.queue.ShutDown()
-	<-t.workerDone
+	if atomic.LoadInt32(&t.started) == 1 {
+		<-t.workerDone
+	}
 }
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"fmt"
+
+	api_v1 "k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServiceIndex is the name of the index of the Ingresses by the <namespace>/<name> of their services
+const ServiceIndex = "service"
+
+// IngressLister lists the Ingresses of an informer.
+// The returned Ingresses are shared with the informer and must not be modified, except the ones of Get.
+type IngressLister struct {
+	cache.Indexer
+}
+
+// Get returns a copy of the Ingress with the <namespace>/<name> key, so it is safe to modify
+func (l *IngressLister) Get(key string) (ing *extensions.Ingress, exists bool, err error) {
+	item, exists, err := l.Indexer.GetByKey(key)
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+	return item.(*extensions.Ingress).DeepCopy(), true, nil
+}
+
+// List lists all the Ingresses
+func (l *IngressLister) List() []*extensions.Ingress {
+	var ings []*extensions.Ingress
+	for _, m := range l.Indexer.List() {
+		ings = append(ings, m.(*extensions.Ingress))
+	}
+	return ings
+}
+
+// ListByNamespace lists the Ingresses of a namespace
+func (l *IngressLister) ListByNamespace(namespace string) []*extensions.Ingress {
+	var ings []*extensions.Ingress
+	cache.ListAllByNamespace(l.Indexer, namespace, labels.Everything(), func(m interface{}) {
+		ings = append(ings, m.(*extensions.Ingress))
+	})
+	return ings
+}
+
+// GetServiceIngress gets all the Ingresses that have backends pointing to a service
+func (l *IngressLister) GetServiceIngress(svc *api_v1.Service) ([]*extensions.Ingress, error) {
+	items, err := l.Indexer.ByIndex(ServiceIndex, svc.Namespace+"/"+svc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("No ingress for service %v", svc.Name)
+	}
+
+	var ings []*extensions.Ingress
+	for _, m := range items {
+		ings = append(ings, m.(*extensions.Ingress))
+	}
+	return ings, nil
+}
+
+// ServiceLister gets the Services of an informer
+type ServiceLister struct {
+	cache.Indexer
+}
+
+// Get returns the Service with the namespace and the name
+func (l *ServiceLister) Get(namespace string, name string) (*api_v1.Service, bool, error) {
+	item, exists, err := l.Indexer.GetByKey(namespace + "/" + name)
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+	return item.(*api_v1.Service), true, nil
+}
+
+// EndpointLister gets the Endpoints of an informer
+type EndpointLister struct {
+	cache.Indexer
+}
+
+// GetServiceEndpoints returns the endpoints of a service, which have the same namespace and name
+func (l *EndpointLister) GetServiceEndpoints(svc *api_v1.Service) (*api_v1.Endpoints, error) {
+	item, exists, err := l.Indexer.GetByKey(svc.Namespace + "/" + svc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("could not find endpoints for service: %v", svc.Name)
+	}
+	return item.(*api_v1.Endpoints), nil
+}
+
+// ConfigMapLister gets the ConfigMaps of an informer
+type ConfigMapLister struct {
+	cache.Indexer
+}
+
+// Get returns the ConfigMap with the <namespace>/<name> key
+func (l *ConfigMapLister) Get(key string) (*api_v1.ConfigMap, bool, error) {
+	item, exists, err := l.Indexer.GetByKey(key)
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+	return item.(*api_v1.ConfigMap), true, nil
+}
+
+// SecretLister gets the Secrets of an informer
+type SecretLister struct {
+	cache.Indexer
+}
+
+// Get returns the Secret with the namespace and the name
+func (l *SecretLister) Get(namespace string, name string) (*api_v1.Secret, bool, error) {
+	item, exists, err := l.Indexer.GetByKey(namespace + "/" + name)
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+	return item.(*api_v1.Secret), true, nil
+}
+
+// PodLister lists the Pods of an informer
+type PodLister struct {
+	cache.Indexer
+}
+
+// Get returns the Pod with the namespace and the name
+func (l *PodLister) Get(namespace string, name string) (*api_v1.Pod, bool, error) {
+	item, exists, err := l.Indexer.GetByKey(namespace + "/" + name)
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+	return item.(*api_v1.Pod), true, nil
+}
+
+// ListBySelector lists the Pods of a namespace whose labels match the selector
+func (l *PodLister) ListBySelector(namespace string, selector labels.Selector) []*api_v1.Pod {
+	var pods []*api_v1.Pod
+	cache.ListAllByNamespace(l.Indexer, namespace, selector, func(m interface{}) {
+		pods = append(pods, m.(*api_v1.Pod))
+	})
+	return pods
+}
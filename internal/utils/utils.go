@@ -22,7 +22,6 @@ import (
 	"strings"
 
 	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/client-go/tools/cache"
 
 	api_v1 "k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
@@ -34,91 +33,6 @@ func compareLinks(l1, l2 string) bool {
 	return l1 == l2 && l1 != ""
 }
 
-// StoreToIngressLister makes a Store that lists Ingress.
-// TODO: Move this to cache/listers post 1.1.
-type StoreToIngressLister struct {
-	cache.Store
-}
-
-// GetByKeySafe calls Store.GetByKeySafe and returns a copy of the ingress so it is
-// safe to modify.
-func (s *StoreToIngressLister) GetByKeySafe(key string) (ing *extensions.Ingress, exists bool, err error) {
-	item, exists, err := s.Store.GetByKey(key)
-	if !exists || err != nil {
-		return nil, exists, err
-	}
-	ing = item.(*extensions.Ingress).DeepCopy()
-	return
-}
-
-// List lists all Ingress' in the store.
-func (s *StoreToIngressLister) List() (ing extensions.IngressList, err error) {
-	for _, m := range s.Store.List() {
-		ing.Items = append(ing.Items, *(m.(*extensions.Ingress)).DeepCopy())
-	}
-	return ing, nil
-}
-
-// GetServiceIngress gets all the Ingress' that have rules pointing to a service.
-// Note that this ignores services without the right nodePorts.
-func (s *StoreToIngressLister) GetServiceIngress(svc *api_v1.Service) (ings []extensions.Ingress, err error) {
-	for _, m := range s.Store.List() {
-		ing := *m.(*extensions.Ingress).DeepCopy()
-		if ing.Namespace != svc.Namespace {
-			continue
-		}
-		if ing.Spec.Backend != nil {
-			if ing.Spec.Backend.ServiceName == svc.Name {
-				ings = append(ings, ing)
-			}
-		}
-		for _, rules := range ing.Spec.Rules {
-			if rules.IngressRuleValue.HTTP == nil {
-				continue
-			}
-			for _, p := range rules.IngressRuleValue.HTTP.Paths {
-				if p.Backend.ServiceName == svc.Name {
-					ings = append(ings, ing)
-				}
-			}
-		}
-	}
-	if len(ings) == 0 {
-		err = fmt.Errorf("No ingress for service %v", svc.Name)
-	}
-	return
-}
-
-// StoreToConfigMapLister makes a Store that lists ConfigMaps
-type StoreToConfigMapLister struct {
-	cache.Store
-}
-
-// List lists all Ingress' in the store.
-func (s *StoreToConfigMapLister) List() (cfgm api_v1.ConfigMapList, err error) {
-	for _, m := range s.Store.List() {
-		cfgm.Items = append(cfgm.Items, *(m.(*api_v1.ConfigMap)))
-	}
-	return cfgm, nil
-}
-
-// StoreToEndpointLister makes a Store that lists Endponts
-type StoreToEndpointLister struct {
-	cache.Store
-}
-
-// GetServiceEndpoints returns the endpoints of a service, matched on service name.
-func (s *StoreToEndpointLister) GetServiceEndpoints(svc *api_v1.Service) (ep api_v1.Endpoints, err error) {
-	for _, m := range s.Store.List() {
-		ep = *m.(*api_v1.Endpoints)
-		if svc.Name == ep.Name && svc.Namespace == ep.Namespace {
-			return ep, nil
-		}
-	}
-	err = fmt.Errorf("could not find endpoints for service: %v", svc.Name)
-	return
-}
-
 // FindPort locates the container port for the given pod and portName.  If the
 // targetPort is a number, use that.  If the targetPort is a string, look that
 // string up in all named ports in all containers in the target pod.  If no
@@ -142,11 +56,6 @@ func FindPort(pod *api_v1.Pod, svcPort *api_v1.ServicePort) (int32, error) {
 	return 0, fmt.Errorf("no suitable port for manifest: %s", pod.UID)
 }
 
-// StoreToSecretLister makes a Store that lists Secrets
-type StoreToSecretLister struct {
-	cache.Store
-}
-
 // IsMinion determines is an ingress is a minion or not
 func IsMinion(ing *extensions.Ingress) bool {
 	if ing.Annotations["nginx.org/mergeable-ingress-type"] == "minion" {